@@ -2,27 +2,61 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"os/user"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/rajeshkio/hosted-rancher-testing/pkg/config"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/diagnostics"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/digitalocean"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/dnscheck"
 	"github.com/rajeshkio/hosted-rancher-testing/pkg/kubectl"
 	"github.com/rajeshkio/hosted-rancher-testing/pkg/rancher"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/reaper"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/report"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/state"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/teardown"
 	"github.com/rajeshkio/hosted-rancher-testing/pkg/terraform"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/testspec"
 )
 
 func main() {
+	defer runCleanups()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "state":
+			os.Exit(runStateCommand(os.Args[2:]))
+		case "reap":
+			os.Exit(runReapCommand(os.Args[2:]))
+		}
+	}
 
 	clusterNameFlag := flag.String("cluster-name", "", "Cluster name (default: rancher-test)")
-	manifestPath := flag.String("manifest", "manifests/nginx.yaml", "Path to test manifest")
+	var specPaths stringList
+	flag.Var(&specPaths, "spec", "Path to a test spec; repeat to run several (default: specs/nginx.yaml and specs/exposure.yaml)")
+	manifestPath := flag.String("manifest", "", "Path to a test manifest to apply and wait for, instead of a spec")
 	destroyFlag := flag.Bool("destroy", false, "Destroy cluster after tests")
 	flag.Parse()
 
+	specs, err := loadSpecs(specPaths, *manifestPath)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
 	var clusterName string
 	if *clusterNameFlag != "" {
 		clusterName = *clusterNameFlag
@@ -32,8 +66,12 @@ func main() {
 		fmt.Println("   Use --cluster-name flag to specify a different name")
 		fmt.Println("   Example: go run cmd/main.go --cluster-name my-test")
 	}
+	if err := terraform.ValidateClusterName(clusterName); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 
-	_, cancel := context.WithCancel(context.Background())
+	runCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	var tfRunner *terraform.Runner
@@ -50,11 +88,13 @@ func main() {
 		if clusterCreated && tfRunner != nil {
 			fmt.Println("\n WARNING: Cluster resources were created")
 			fmt.Println("To clean up run:")
-			fmt.Printf("  cd %s && terraform destroy --auto-approve\n", tfRunner.WorkDir)
+			fmt.Printf("  cd %s && %s destroy --auto-approve\n", tfRunner.WorkDir, tfRunner.CLIName())
 		}
 
 		fmt.Println("\nExisting...")
 		cancel()
+		// Skip failure diagnostics: the user asked us to stop.
+		runCleanups()
 		os.Exit(1)
 	}()
 
@@ -62,73 +102,211 @@ func main() {
 	cfg, err := config.ReadConfig()
 	if err != nil {
 		fmt.Println("Error reading config:", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	// The oldest run_state.json belongs to the cluster in the old shared
+	// terraform state, if it is still there.
+	legacyCluster := terraform.TemplateStateClusterName("./terraform", cfg.Provider)
+	if legacyCluster == "" {
+		legacyCluster = clusterName
+	}
+	store, err := state.Open(cfg.StateDir, legacyCluster)
+	if err != nil {
+		fmt.Println("Error opening run state:", err)
+		exit(1)
+	}
+	stateLock, err := store.Lock(clusterName, cfg.RunID)
+	if err != nil {
+		fmt.Println("Error:", err)
+		exit(1)
 	}
+	addCleanup(func() {
+		if err := stateLock.Release(); err != nil {
+			fmt.Println("Warning:", err)
+		}
+	})
 
 	fmt.Println("\n=== Step 2: Connecting to Rancher ===")
+	ephemeralToken := cfg.UsePasswordLogin()
+	if ephemeralToken {
+		runToken, err := createRunToken(cfg, estimateRunDuration(cfg))
+		if err != nil {
+			fmt.Println("Error logging in to Rancher:", err)
+			exit(1)
+		}
+		cfg.Token = runToken
+	}
+
 	client, err := rancher.NewClient(cfg.RancherURL, cfg.Token)
 	if err != nil {
 		fmt.Println("Error connecting to Rancher:", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	runReport := report.New(cfg.RunID, clusterName)
+	diag := &diagnostics.Sources{Rancher: client, ClusterName: clusterName}
+	onFailure(func() {
+		collectDiagnostics(cfg, diag, runReport)
+		finishReport(cfg, runReport, false)
+	})
+	if ephemeralToken {
+		addCleanup(func() {
+			if err := client.DeleteToken(cfg.Token); err != nil {
+				fmt.Println("Warning: could not delete run token:", err)
+				return
+			}
+			fmt.Println("Run token deleted")
+		})
 	}
 
 	err = client.VerifyLogin()
 	if err != nil {
 		fmt.Println("Error verifying login:", err)
-		os.Exit(1)
+		exit(1)
 	}
 	fmt.Println("Connected to Rancher successfully:", client.URL)
 
+	runDuration := estimateRunDuration(cfg)
+	token, warnings, err := client.CheckToken(runDuration)
+	if err != nil {
+		fmt.Println("Error checking token:", err)
+		exit(1)
+	}
+	if token.Expires() {
+		fmt.Printf("  Token %s (user %s) expires at %s\n", token.Name, token.UserID, token.ExpiresAt.Format(time.RFC3339))
+	} else {
+		fmt.Printf("  Token %s (user %s) does not expire\n", token.Name, token.UserID)
+	}
+	for _, w := range warnings {
+		fmt.Println("  Warning:", w)
+	}
+
 	fmt.Println("\n=== Step 3: Checking cloud provider credentials")
 	providerVars, err := getProviderVars(cfg.Provider)
 	if err != nil {
 		fmt.Println("Error:", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Printf("%s credentials configured\n", cfg.Provider)
 
+	createdAt := time.Now()
+	ownership := rancher.Ownership{
+		Cluster:   clusterName,
+		RunID:     cfg.RunID,
+		Owner:     runOwner(cfg, token),
+		GitCommit: gitCommit(cfg),
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(cfg.ClusterTTL),
+	}
+	if cfg.Provider == "digitalocean" {
+		providerVars["do_tags"] = strings.Join(ownership.DropletTags(), ",")
+	}
+	fmt.Printf("  Resources owned by %s, expiring at %s\n", ownership.Owner, ownership.ExpiresAt.Format(time.RFC3339))
+
 	fmt.Println("\n=== Step 4: Initializing Terraform ===")
-	tfRunner = terraform.NewRunner("./terraform", cfg.Provider)
+	tfRunner = terraform.NewRunner("./terraform", cfg.Provider, clusterName)
+	tfBinary, err := terraform.FindBinary(terraform.BinaryOptions{
+		Name:       cfg.TFBinary,
+		Path:       cfg.TFBinaryPath,
+		CacheDir:   cfg.TFBinaryCache,
+		Constraint: cfg.TFVersion,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		exit(1)
+	}
+	tfRunner.Binary = tfBinary
+	runReport.Terraform = fmt.Sprintf("%s %s", tfBinary.Name, tfBinary.Version)
+	fmt.Printf("  Using %s\n", tfBinary)
+	if cfg.TFBackend != "" {
+		if err := terraform.ValidateBackendType(cfg.TFBackend); err != nil {
+			fmt.Println("Error:", err)
+			exit(1)
+		}
+		tfRunner.Backend = &terraform.Backend{Type: cfg.TFBackend, Config: cfg.TFBackendConfig}
+		fmt.Printf("  Using %s backend for terraform state\n", cfg.TFBackend)
+	}
+	tfRunner.Labels = ownership.Labels()
+	tfRunner.Annotations = ownership.Annotations()
+	tfRunner.Retries = cfg.TFRetries
+	tfRunner.RetryBackoff = cfg.TFRetryBackoff
+	tfRunner.OnRetry = func(retry terraform.Retry) {
+		runReport.TerraformRetries = append(runReport.TerraformRetries, retry)
+	}
+	diag.Terraform = tfRunner
 
 	if err := tfRunner.Init(); err != nil {
 		fmt.Println("Error:", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Println("\n=== Step 5: Preparing cluster configuration ===")
-	fmt.Println("\n=== Step 5: Preparing cluster configuration ===")
-	state := terraform.LoadState()
-	fmt.Printf("  cluster_deployed=%v cluster_upgraded=%v\n", state.ClusterDeployed, state.ClusterUpgraded)
+	record := reconcileState(store, client, tfRunner, clusterName, cfg.K3sUpgradeVersion)
+	fmt.Printf("  cluster_deployed=%v cluster_upgraded=%v\n", record.ClusterDeployed, record.ClusterUpgraded)
 
 	if *destroyFlag {
 		fmt.Println("\n=== Destroy Mode ===")
+		stateCluster, err := tfRunner.StateClusterName()
+		if err != nil {
+			fmt.Println("Error reading terraform state:", err)
+			exit(1)
+		}
+		if stateCluster != "" && stateCluster != clusterName {
+			fmt.Printf("Error: terraform state in %s belongs to cluster %q, not %q; refusing to destroy\n", tfRunner.WorkDir, stateCluster, clusterName)
+			exit(1)
+		}
 		if err := tfRunner.WriteTfvars(cfg.RancherURL, cfg.Token, cfg.K3sVersion, clusterName, providerVars); err != nil {
 			fmt.Println("Error:", err)
-			os.Exit(1)
+			exit(1)
 		}
 		if err := tfRunner.Destroy(); err != nil {
 			fmt.Println("Error:", err)
-			os.Exit(1)
+			exit(1)
+		}
+		record.ClusterDeployed, record.ClusterUpgraded = false, false
+		record.ClusterID, record.CurrentVersion = "", ""
+		record.AddStep("cluster-destroyed", cfg.RunID)
+		if err := store.Save(record); err != nil {
+			fmt.Println("Warning: could not save state:", err)
+		}
+
+		fmt.Println("\n=== Verifying teardown ===")
+		if err := teardown.Verify(runCtx, teardownChecks(cfg, client, clusterName, providerVars), teardown.Options{Timeout: cfg.TeardownTimeout}, os.Stdout); err != nil {
+			fmt.Println("Error:", err)
+			fmt.Println("  Delete the leftovers by hand, or run the reap command for Rancher objects")
+			exit(1)
+		}
+		record.AddStep("teardown-verified", cfg.RunID)
+		if err := store.Save(record); err != nil {
+			fmt.Println("Warning: could not save state:", err)
 		}
-		terraform.ClearState()
 		fmt.Println("Cluster destroyed")
 		return
 	}
 
 	fmt.Println("\n=== Step 6: Creating downstream cluster ===")
-	if !state.ClusterDeployed {
+	if !record.ClusterDeployed {
 		if err := tfRunner.WriteTfvars(cfg.RancherURL, cfg.Token, cfg.K3sVersion, clusterName, providerVars); err != nil {
 			fmt.Println("Error: ", err)
-			os.Exit(1)
+			exit(1)
+		}
+		record.AddStep("apply-started", cfg.RunID)
+		if err := store.Save(record); err != nil {
+			fmt.Println("Warning: could not save state:", err)
 		}
-		if err := tfRunner.Apply(); err != nil {
+		stopWatch := watchMachines(runCtx, client, clusterName)
+		err := tfRunner.Apply()
+		stopWatch()
+		if err != nil {
 			fmt.Println("Error:", err)
-			os.Exit(1)
+			exit(1)
 		}
-		state.ClusterDeployed = true
-		state.CurrentVersion = cfg.K3sVersion
-		if err := terraform.SaveState(state); err != nil {
+		record.ClusterDeployed = true
+		record.CurrentVersion = cfg.K3sVersion
+		record.AddStep("cluster-created", cfg.RunID)
+		if err := store.Save(record); err != nil {
 			fmt.Println("Warning: could not save state:", err)
 		}
 	} else {
@@ -139,91 +317,95 @@ func main() {
 	outputs, err := tfRunner.GetOutputs()
 	if err != nil {
 		fmt.Println("Error:", err)
-		os.Exit(1)
+		exit(1)
 	}
-	if state.ClusterID == "" {
-		state.ClusterID = outputs.ClusterID
-		terraform.SaveState(state)
+	if record.ClusterID == "" {
+		record.ClusterID = outputs.ClusterID
+		if err := store.Save(record); err != nil {
+			fmt.Println("Warning: could not save state:", err)
+		}
 	}
+	diag.ClusterID = outputs.ClusterID
+	runReport.ClusterID = outputs.ClusterID
 
 	fmt.Println("\n=== Step 8: Getting the kubeconfig ===")
 	kubeconfig, err := client.GetKubeconfig(outputs.ClusterID)
 	if err != nil {
 		fmt.Println("Error:", err)
 		fmt.Println("Cluster created but couldn't get kubeconfig")
-		os.Exit(1)
+		exit(1)
 	}
 
 	fmt.Println(" kubeconfig obtained")
 
 	fmt.Println("\n=== Step 9: Setting up kubectl ===")
-	k8s, err := kubectl.NewRunner(kubeconfig)
+	k8s, err := kubectl.NewRunner(kubeconfig, cfg.KubeClient)
 	if err != nil {
 		fmt.Println("Error:", err)
-		os.Exit(1)
+		exit(1)
 	}
 	defer k8s.Cleanup()
+	diag.Kubectl = k8s
 
-	// --- Step 10: Deploying test application ---
-	fmt.Println("\n=== Step 10: Deploying test application ===")
+	// --- Step 10: Deploying test specs ---
+	fmt.Println("\n=== Step 10: Deploying test specs ===")
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	if err := k8s.Apply(ctx, *manifestPath); err != nil {
-		fmt.Println("Error deploying manifest:", err)
-		os.Exit(1)
+	for _, spec := range specs {
+		if err := spec.Deploy(ctx, k8s, os.Stdout); err != nil {
+			fmt.Println("Error deploying test spec:", err)
+			exit(1)
+		}
 	}
-	fmt.Println("Application deployed")
+	fmt.Println("Test specs deployed")
 
 	// --- Global Health Check ---
 	fmt.Println("\n=== Checking for Unhealthy Pods (Cluster-wide) ===")
 	// Use a fresh context for health check
 	healthCtx, healthCancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer healthCancel()
+	podFilter := kubectl.PodFilter{Namespaces: cfg.HealthNamespaces, ExcludeNamespaces: cfg.HealthExcludeNamespaces}
 	fmt.Println("Waiting for all cluster pods to reach Ready state...")
-	if err := k8s.WaitForAllPodsReady(healthCtx); err != nil {
+	if err := k8s.WaitForAllPodsReady(healthCtx, podFilter); err != nil {
 		fmt.Printf("\nTEST FAILED: Pods are not ready: %v\n", err)
-		os.Exit(1)
+		printUnhealthyPods(err)
+		exit(1)
 	}
 	fmt.Println("All pods are healthy/running.")
 
-	fmt.Println("\n=== Step 11: Waiting for test-app pod to be ready ===")
-	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer waitCancel()
+	fmt.Println("\n=== Step 11: Waiting for test resources ===")
+	runSpecStep(specs, k8s, (*testspec.Spec).WaitReady)
 
-	pods, err := k8s.GetPods(waitCtx, "test-app", "app=nginx")
-	if err != nil || len(pods) == 0 {
-		fmt.Println("Error: No pods found in namespace test-app")
-		os.Exit(1)
-	}
+	fmt.Println("\n=== Step 12: Testing pod logs ===")
+	runSpecStep(specs, k8s, (*testspec.Spec).CheckLogs)
 
-	fmt.Printf("Found pod: %s. Waiting for 'Ready' condition...\n", pods[0])
-	if err := k8s.WaitForPod(waitCtx, "test-app", pods[0]); err != nil {
-		fmt.Println("Error waiting for pod:", err)
-		os.Exit(1)
+	fmt.Println("\n=== Ingress controllers ===")
+	ingressCtx, ingressCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer ingressCancel()
+	controllers, err := k8s.IngressControllers(ingressCtx)
+	switch {
+	case err != nil:
+		fmt.Println("Warning: could not list ingress controllers:", err)
+	case len(controllers) == 0:
+		fmt.Println("  No Traefik or ingress-nginx controller found")
 	}
-
-	fmt.Printf("\n=== Step 12: Testing pod logs ===")
-	logCtx, logCancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer logCancel()
-
-	logs, err := k8s.Logs(logCtx, "test-app", pods[0], 10)
-	if err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+	for _, c := range controllers {
+		fmt.Printf("  %s\n", c)
+		runReport.IngressControllers = append(runReport.IngressControllers, c.String())
 	}
-	fmt.Printf(" logs retrieved (%d bytes)\n", len(logs))
 
-	fmt.Println("\n=== Step 13: Testing pod exec ===")
-	execCtx, execCancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer execCancel()
+	fmt.Println("\n=== Step 13: Testing pod exec and HTTP probes ===")
+	runSpecStep(specs, k8s, (*testspec.Spec).CheckExec)
+	runSpecStep(specs, k8s, (*testspec.Spec).CheckHTTP)
 
-	output, err := k8s.Exec(execCtx, "test-app", pods[0], []string{"nginx", "-v"})
+	fmt.Println("\n=== Checking cluster DNS ===")
+	dnsOptions, err := dnsCheckOptions(cfg, specs)
 	if err != nil {
 		fmt.Println("Error:", err)
-		os.Exit(1)
+		exit(1)
 	}
-	fmt.Printf("Exec successful: %s\n", output)
+	checkDNS(k8s, dnsOptions)
 
 	if cfg.K3sUpgradeVersion != "" {
 		fmt.Println("\n" + strings.Repeat("=", 50))
@@ -234,31 +416,82 @@ func main() {
 		preCluster, err := client.GetCluster(outputs.ClusterID)
 		if err != nil {
 			fmt.Println("Error getting cluster:", err)
-			os.Exit(1)
+			exit(1)
 		}
 		if preCluster.K3sConfig != nil {
 			fmt.Printf(" Current version: %s\n", preCluster.K3sConfig.Version)
 		}
+		v2Cluster, err := client.GetProvisioningCluster(outputs.ClusterName)
+		if err != nil {
+			fmt.Println("Error getting provisioning cluster:", err)
+			exit(1)
+		}
+		if v2Cluster != nil {
+			fmt.Printf(" Provisioning spec version: %s\n", v2Cluster.Spec.KubernetesVersion)
+			if pending := v2Cluster.Pending(); pending != "" {
+				fmt.Printf(" Warning: cluster has not settled before upgrade: %s\n", pending)
+			}
+		}
 		fmt.Printf(" Upgrade target: %s\n", cfg.K3sUpgradeVersion)
 
 		fmt.Println("\n=== Step 15: Triggering Kubernetes version upgrade ===")
-		if !state.ClusterUpgraded {
+		if !record.ClusterUpgraded {
 			if err := tfRunner.WriteTfvars(cfg.RancherURL, cfg.Token, cfg.K3sUpgradeVersion, clusterName, providerVars); err != nil {
 				fmt.Println("Error writing updated tfvars:", err)
-				os.Exit(1)
+				exit(1)
 			}
 
-			if err := tfRunner.Apply(); err != nil {
-				fmt.Println("Error applying terraform upgrade:", err)
-				os.Exit(1)
+			plan, err := tfRunner.Plan()
+			if err != nil {
+				fmt.Println("Error planning upgrade:", err)
+				exit(1)
+			}
+			// exit skips defers, so the plan file is also removed on the way out.
+			addCleanup(plan.Discard)
+			for _, change := range plan.Changes {
+				fmt.Printf("  plan: %s\n", change)
 			}
-			fmt.Println("Upgrade apply completed")
+			if !plan.HasChanges() {
+				// e.g. a run recovered from terraform state after the upgrade apply.
+				fmt.Println("  No changes planned, cluster spec is already at the target version")
+			} else {
+				if err := plan.VerifyUpgradeOnly(); err != nil {
+					fmt.Println("Error:", err)
+					exit(1)
+				}
+
+				if err := tfRunner.ApplyPlan(plan); err != nil {
+					fmt.Println("Error applying terraform upgrade:", err)
+					exit(1)
+				}
+				record.AddStep("upgrade-applied", cfg.RunID)
+				if err := store.Save(record); err != nil {
+					fmt.Println("Warning: could not save state:", err)
+				}
+				fmt.Println("Upgrade apply completed")
+			}
+			plan.Discard()
 
 			fmt.Println("\n=== Step 16: Waiting for cluster upgrade to complete ===")
 			fmt.Println("This may take 10-15 minutes ...")
-			if err := client.WaitForClusterReady(outputs.ClusterID, 15*time.Minute); err != nil {
+			upgradeCtx, upgradeCancel := context.WithTimeout(runCtx, 15*time.Minute)
+			defer upgradeCancel()
+			stopWatch := watchMachines(upgradeCtx, client, outputs.ClusterName)
+			err = client.WaitForClusterReady(upgradeCtx, outputs.ClusterID, printClusterProgress)
+			stopWatch()
+			if err != nil {
 				fmt.Println("Error waiting for upgrade:", err)
-				os.Exit(1)
+				exit(1)
+			}
+			if err := client.VerifyUpgrade(outputs.ClusterName, cfg.K3sUpgradeVersion); err != nil {
+				fmt.Println("Error verifying upgrade:", err)
+				exit(1)
+			}
+			record.ClusterUpgraded = true
+			record.CurrentVersion = cfg.K3sUpgradeVersion
+			record.AddStep("cluster-upgraded", cfg.RunID)
+			if err := store.Save(record); err != nil {
+				fmt.Println("Warning: could not save state:", err)
 			}
 			fmt.Println("Cluster upgrade completed")
 		} else {
@@ -270,16 +503,17 @@ func main() {
 		newKubeconfig, err := client.GetKubeconfig(outputs.ClusterID)
 		if err != nil {
 			fmt.Println("Error getting kubeconfig after upgrade:", err)
-			os.Exit(1)
+			exit(1)
 		}
 
-		k8s, err = kubectl.NewRunner(newKubeconfig)
+		k8s, err = kubectl.NewRunner(newKubeconfig, cfg.KubeClient)
 		if err != nil {
 			fmt.Println("Error setiing up kubectl: ", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		defer k8s.Cleanup()
+		diag.Kubectl = k8s
 		fmt.Println("kubeconfig refreshed")
 
 		fmt.Println("\n === Step 18: Verifying node Kubernetes versions ===")
@@ -289,7 +523,7 @@ func main() {
 		nodeVersions, err := k8s.GetNodeVersions(nodeCtx)
 		if err != nil {
 			fmt.Println("Error getting node versions:", err)
-			os.Exit(1)
+			exit(1)
 		}
 		for _, nv := range nodeVersions {
 			fmt.Printf("  %s\n", nv)
@@ -300,22 +534,20 @@ func main() {
 		defer postHealthCancel()
 
 		fmt.Println("Waiting for all cluster pods to reach Ready state...")
-		if err := k8s.WaitForAllPodsReady(postHealthCtx); err != nil {
-			fmt.Printf("\nUPGRADE TEST FAILED: Pods did not stabilize after upgrade")
-			os.Exit(1)
+		if err := k8s.WaitForAllPodsReady(postHealthCtx, podFilter); err != nil {
+			fmt.Printf("\nUPGRADE TEST FAILED: Pods did not stabilize after upgrade: %v\n", err)
+			printUnhealthyPods(err)
+			exit(1)
 		}
 		fmt.Println("All pods are healthy after upgrade")
 
-		// Re-verify the test app pod
-		postWaitCtx, postWaitCancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer postWaitCancel()
+		// Re-run the test specs' checks against the upgraded cluster.
+		fmt.Println("Re-running test spec checks...")
+		runSpecStep(specs, k8s, (*testspec.Spec).Check)
+		fmt.Println("Test specs still pass after upgrade")
 
-		postPods, err := k8s.GetPods(postWaitCtx, "test-app", "app=nginx")
-		if err != nil || len(postPods) == 0 {
-			fmt.Println("Error: test-app pods not found after upgrade")
-			os.Exit(1)
-		}
-		fmt.Printf("Test app pod %s still running after upgrade\n", postPods[0])
+		fmt.Println("Re-checking cluster DNS...")
+		checkDNS(k8s, dnsOptions)
 
 		fmt.Println("\n" + strings.Repeat("=", 50))
 		fmt.Println("UPGRADE TEST PASSED!")
@@ -323,6 +555,21 @@ func main() {
 		fmt.Println(strings.Repeat("=", 50))
 	}
 
+	fmt.Println("\n=== Cleaning up test specs ===")
+	cleanCtx, cleanCancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cleanCancel()
+	for _, spec := range specs {
+		if err := spec.Clean(cleanCtx, k8s, os.Stdout); err != nil {
+			fmt.Println("Warning: cleanup failed:", err)
+		}
+	}
+
+	fmt.Println("\n=== Collecting Rancher agent logs ===")
+	agentCtx, agentCancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer agentCancel()
+	runReport.AgentLogs = diagnostics.CollectAgentLogs(agentCtx, k8s, cfg.AgentJournal)
+	finishReport(cfg, runReport, true)
+
 	fmt.Println("\n" + strings.Repeat("=", 50))
 	fmt.Println("ALL TESTS PASSED!")
 	fmt.Println(strings.Repeat("=", 50))
@@ -332,9 +579,10 @@ func main() {
 	fmt.Println("\nTests completed:")
 	fmt.Println("  Cluster provisioning")
 	fmt.Println("  Kubeconfig access")
-	fmt.Println("  Application deployment")
-	fmt.Println("  Pod logs")
-	fmt.Println("  Pod exec")
+	for _, spec := range specs {
+		fmt.Printf("  Test spec %s\n", spec.Name)
+	}
+	fmt.Println("  Cluster DNS")
 	if cfg.K3sUpgradeVersion != "" {
 		fmt.Printf("  Kubernetes upgrade (%s -> %s)\n", cfg.K3sVersion, cfg.K3sUpgradeVersion)
 	}
@@ -343,6 +591,414 @@ func main() {
 
 }
 
+// The hooks are registered by the main flow and run from exit or the
+// signal handler, so hooksMu guards both lists.
+var (
+	hooksMu      sync.Mutex
+	cleanups     []func()
+	failureHooks []func()
+	cleanupOnce  sync.Once
+)
+
+// onFailure registers a function to run when the program exits with a
+// non-zero code, before cleanups.
+func onFailure(f func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	failureHooks = append(failureHooks, f)
+}
+
+// addCleanup registers a function to run when the program exits, whether it
+// finishes normally, fails or is interrupted. Cleanups run in reverse order.
+func addCleanup(f func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	cleanups = append(cleanups, f)
+}
+
+// runCleanups runs the registered cleanups once; later calls wait for the
+// first to finish.
+func runCleanups() {
+	cleanupOnce.Do(func() {
+		hooksMu.Lock()
+		fns := slices.Clone(cleanups)
+		hooksMu.Unlock()
+		for i := len(fns) - 1; i >= 0; i-- {
+			fns[i]()
+		}
+	})
+}
+
+// exit runs failure hooks (for non-zero codes) and registered cleanups before
+// exiting, since os.Exit skips defers.
+func exit(code int) {
+	if code != 0 {
+		hooksMu.Lock()
+		fns := slices.Clone(failureHooks)
+		hooksMu.Unlock()
+		for _, f := range fns {
+			f()
+		}
+	}
+	runCleanups()
+	os.Exit(code)
+}
+
+// collectDiagnostics writes a redacted failure bundle for whatever the run
+// had set up before failing.
+func collectDiagnostics(cfg *config.Config, diag *diagnostics.Sources, runReport *report.Report) {
+	fmt.Println("\n=== Collecting failure diagnostics ===")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if diag.Kubectl != nil {
+		diag.AgentLogs = diagnostics.CollectAgentLogs(ctx, diag.Kubectl, true)
+		runReport.AgentLogs = diag.AgentLogs
+	}
+
+	redactor := diagnostics.NewRedactor(cfg.Token, cfg.Password, os.Getenv("DO_TOKEN"))
+	name := fmt.Sprintf("%s-%s-failure", runReport.ClusterName, cfg.RunID)
+	path, err := diagnostics.Collect(ctx, diag, cfg.ArtifactsDir, name, redactor)
+	if err != nil {
+		fmt.Println("Warning: could not write diagnostics bundle:", err)
+		return
+	}
+	fmt.Println("Diagnostics bundle written to", path)
+}
+
+// finishReport prints the run report and saves it under the artifacts dir.
+func finishReport(cfg *config.Config, runReport *report.Report, passed bool) {
+	runReport.Finish(passed)
+	runReport.Print(os.Stdout)
+	path, err := runReport.Write(cfg.ArtifactsDir)
+	if err != nil {
+		fmt.Println("Warning: could not write run report:", err)
+		return
+	}
+	fmt.Println("Run report written to", path)
+}
+
+// createRunToken logs in with the configured service user and mints a token
+// scoped to this run. The login session token is deleted straight away so
+// only the run token outlives this function.
+func createRunToken(cfg *config.Config, runDuration time.Duration) (string, error) {
+	sessionToken, err := rancher.Login(cfg.RancherURL, cfg.Username, cfg.Password)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := rancher.NewClient(cfg.RancherURL, sessionToken)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := session.DeleteToken(sessionToken); err != nil {
+			fmt.Println("  Warning: could not delete login session token:", err)
+		}
+	}()
+
+	ttl := cfg.TokenTTL
+	if ttl == 0 {
+		ttl = runDuration + 30*time.Minute
+	}
+	runToken, err := session.CreateToken(fmt.Sprintf("hosted-rancher-testing run %s", cfg.RunID), ttl)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("  Logged in as %s, created run token (ttl %s)\n", cfg.Username, ttl)
+	return runToken, nil
+}
+
+// reconcileState loads the recorded state for a cluster and replaces it
+// with what terraform state and Rancher actually show, warning about and
+// saving any difference. If either can't be inspected the recorded state is
+// used as is.
+func reconcileState(store *state.Store, client *rancher.Client, tfRunner *terraform.Runner, clusterName, upgradeVersion string) *state.Record {
+	record, err := store.Load(clusterName)
+	if err != nil {
+		fmt.Println("  Warning:", err)
+		record = &state.Record{Cluster: clusterName}
+	}
+
+	tfCluster, err := tfRunner.StateCluster()
+	if err != nil {
+		fmt.Println("  Warning: could not inspect terraform state, using recorded run state:", err)
+		return record
+	}
+	rancherCluster, err := client.GetProvisioningCluster(clusterName)
+	if err != nil {
+		fmt.Println("  Warning: could not inspect Rancher, using recorded run state:", err)
+		return record
+	}
+
+	observed := state.Observed{Terraform: tfCluster}
+	if rancherCluster != nil {
+		observed.RancherFound = true
+		observed.RancherClusterID = rancherCluster.Status.ClusterName
+		observed.RancherVersion = rancherCluster.Spec.KubernetesVersion
+		observed.RancherReady = rancherCluster.Pending() == ""
+	}
+
+	drift := state.Reconcile(record, observed, upgradeVersion)
+	for _, d := range drift {
+		fmt.Println("  Drift:", d)
+	}
+	if len(drift) > 0 {
+		if err := store.Save(record); err != nil {
+			fmt.Println("  Warning: could not save state:", err)
+		} else {
+			fmt.Println("  Repaired run state from terraform and Rancher")
+		}
+	}
+	return record
+}
+
+// runReapCommand handles `reap`: deleting clusters and Rancher objects
+// left behind by earlier runs.
+func runReapCommand(args []string) int {
+	fs := flag.NewFlagSet("reap", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 24*time.Hour, "Reap objects older than this")
+	finished := fs.Bool("finished", false, "Also reap clusters of runs from this machine that have ended")
+	dryRun := fs.Bool("dry-run", false, "Only print what would be deleted")
+	wait := fs.Duration("wait", 10*time.Minute, "How long to wait for clusters to be removed before deleting their credentials and machine configs")
+	fs.Parse(args)
+
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		fmt.Println("Error reading config:", err)
+		return 1
+	}
+
+	token := cfg.Token
+	if cfg.UsePasswordLogin() {
+		token, err = rancher.Login(cfg.RancherURL, cfg.Username, cfg.Password)
+		if err != nil {
+			fmt.Println("Error logging in to Rancher:", err)
+			return 1
+		}
+	}
+	client, err := rancher.NewClient(cfg.RancherURL, token)
+	if err != nil {
+		fmt.Println("Error connecting to Rancher:", err)
+		return 1
+	}
+	if cfg.UsePasswordLogin() {
+		defer func() {
+			if err := client.DeleteToken(token); err != nil {
+				fmt.Println("Warning: could not delete login token:", err)
+			}
+		}()
+	}
+
+	opts := reaper.Options{TTL: *ttl, DryRun: *dryRun, Wait: *wait}
+	if *finished {
+		store, err := state.Open(cfg.StateDir, "")
+		if err != nil {
+			fmt.Println("Error opening run state:", err)
+			return 1
+		}
+		opts.Finished = store.RunFinished
+	}
+
+	if err := reaper.Run(context.Background(), client, opts, os.Stdout); err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runStateCommand handles `state ...` without needing a Rancher config.
+func runStateCommand(args []string) int {
+	store, err := state.Open(config.StateDir(), "")
+	if err == nil {
+		err = state.RunCommand(store, args, os.Stdout)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// watchMachines prints a live table of the cluster's machines in the
+// background until the returned stop function is called.
+func watchMachines(ctx context.Context, client *rancher.Client, clusterName string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.WatchMachines(ctx, clusterName, 30*time.Second, os.Stdout)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// printClusterProgress renders a cluster state change, listing any
+// conditions that are not yet True.
+func printClusterProgress(p rancher.ClusterProgress) {
+	fmt.Printf(" [%s] Cluster state: %s | transitioning: %s\n", time.Now().Format("15:04:05"), p.State, p.TransitioningMessage)
+	for _, cond := range p.Conditions {
+		if cond.Status == "True" {
+			continue
+		}
+		fmt.Printf("    %-28s %-7s %s\n", cond.Type, cond.Status, cond.Message)
+	}
+	if p.Pending != "" {
+		fmt.Printf("    provisioning: %s\n", p.Pending)
+	}
+}
+
+// estimateRunDuration is a generous upper bound for a full run, used to
+// reject tokens that would expire partway through.
+func estimateRunDuration(cfg *config.Config) time.Duration {
+	d := 30 * time.Minute // provisioning + app tests
+	if cfg.K3sUpgradeVersion != "" {
+		d += 25 * time.Minute // upgrade apply + wait + re-validation
+	}
+	return d
+}
+
+// runOwner is who the run's resources are recorded as belonging to: OWNER,
+// else the local user, else the Rancher user the token belongs to.
+func runOwner(cfg *config.Config, token *rancher.TokenInfo) string {
+	if cfg.Owner != "" {
+		return cfg.Owner
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return token.UserID
+}
+
+// gitCommit is the harness commit recorded on created resources: GIT_COMMIT,
+// else the checkout's HEAD, else empty.
+func gitCommit(cfg *config.Config) string {
+	if cfg.GitCommit != "" {
+		return cfg.GitCommit
+	}
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// defaultSpecs run when neither --spec nor --manifest is given.
+var defaultSpecs = []string{"specs/nginx.yaml", "specs/exposure.yaml"}
+
+// loadSpecs loads the --spec files, or wraps --manifest in a spec. With
+// neither, the default specs run.
+func loadSpecs(paths []string, manifestPath string) ([]*testspec.Spec, error) {
+	var specs []*testspec.Spec
+	if manifestPath != "" {
+		specs = append(specs, testspec.FromManifest(manifestPath))
+	}
+	if len(paths) == 0 && manifestPath == "" {
+		paths = defaultSpecs
+	}
+	for _, path := range paths {
+		spec, err := testspec.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// runSpecStep runs one phase of every spec, exiting on the first failure.
+// Each check applies its own timeout.
+func runSpecStep(specs []*testspec.Spec, k8s kubectl.Runner, step func(*testspec.Spec, context.Context, kubectl.Runner, io.Writer) error) {
+	for _, spec := range specs {
+		if err := step(spec, context.Background(), k8s, os.Stdout); err != nil {
+			fmt.Println("Error:", err)
+			exit(1)
+		}
+	}
+}
+
+// dnsCheckOptions resolves the specs' services and an external name: the
+// Rancher server's hostname unless DNS_EXTERNAL_NAME is set, since the
+// cluster has to reach Rancher anyway.
+func dnsCheckOptions(cfg *config.Config, specs []*testspec.Spec) (dnscheck.Options, error) {
+	opts := dnscheck.Options{Namespace: "default", External: cfg.DNSExternalName}
+	if opts.External == "" {
+		if u, err := url.Parse(cfg.RancherURL); err == nil && net.ParseIP(u.Hostname()) == nil {
+			opts.External = u.Hostname()
+		}
+	}
+	for _, spec := range specs {
+		for _, m := range spec.Manifests {
+			services, err := kubectl.ManifestServices(m)
+			if err != nil {
+				return opts, err
+			}
+			opts.Services = append(opts.Services, services...)
+		}
+	}
+	return opts, nil
+}
+
+// checkDNS runs the cluster DNS check, exiting on failure.
+func checkDNS(k8s kubectl.Runner, opts dnscheck.Options) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	if _, err := dnscheck.Check(ctx, k8s, opts, os.Stdout); err != nil {
+		fmt.Println("Error:", err)
+		exit(1)
+	}
+	fmt.Println("Cluster DNS is healthy")
+}
+
+// printUnhealthyPods prints the grouped pod table of a WaitForAllPodsReady
+// timeout.
+func printUnhealthyPods(err error) {
+	var notReady *kubectl.NotReadyError
+	if errors.As(err, &notReady) {
+		kubectl.WriteUnhealthyPods(os.Stdout, notReady.Pods)
+	}
+}
+
+// teardownChecks look for anything of the cluster left in Rancher and at
+// the cloud provider after terraform destroy.
+func teardownChecks(cfg *config.Config, client *rancher.Client, clusterName string, providerVars map[string]string) []teardown.Check {
+	checks := []teardown.Check{{
+		Name:      "rancher",
+		Leftovers: func() ([]string, error) { return client.Leftovers(clusterName) },
+	}}
+	if cfg.Provider == "digitalocean" {
+		do := digitalocean.NewClient(providerVars["do_token"])
+		tag := rancher.ClusterTag(clusterName)
+		checks = append(checks, teardown.Check{
+			Name: "digitalocean",
+			Leftovers: func() ([]string, error) {
+				resources, err := do.ListTagged(tag)
+				if err != nil {
+					return nil, err
+				}
+				leftovers := make([]string, 0, len(resources))
+				for _, r := range resources {
+					leftovers = append(leftovers, r.String())
+				}
+				return leftovers, nil
+			},
+		})
+	}
+	return checks
+}
+
 func getProviderVars(provider string) (map[string]string, error) {
 	vars := make(map[string]string)
 
@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,7 +17,57 @@ type Config struct {
 	K3sUpgradeVersion string
 	RancherURL        string
 	Token             string
+	Username          string
+	Password          string
+	TokenTTL          time.Duration
 	Provider          string
+	RunID             string
+	ArtifactsDir      string
+	// TFBackend is the terraform remote backend type ("" for local state)
+	// and TFBackendConfig its shared -backend-config settings.
+	TFBackend       string
+	TFBackendConfig map[string]string
+	// TFRetries is how many times a transiently failed terraform apply or
+	// destroy is retried, waiting TFRetryBackoff (doubling) in between.
+	TFRetries      int
+	TFRetryBackoff time.Duration
+	// TFBinary is "terraform" or "tofu". TFBinaryPath pins an exact binary,
+	// TFBinaryCache is a directory of pre-downloaded binaries and
+	// TFVersion a version constraint the binary must satisfy.
+	TFBinary      string
+	TFBinaryPath  string
+	TFBinaryCache string
+	TFVersion     string
+	// StateDir holds per-cluster run state and locks.
+	StateDir string
+	// Owner is recorded on created resources; ClusterTTL says how long
+	// after creation they may be reaped.
+	Owner      string
+	ClusterTTL time.Duration
+	// GitCommit is the harness commit recorded on created resources.
+	GitCommit string
+	// KubeClient selects the kubectl package backend: "client-go" (the
+	// default) or "kubectl" to shell out to the kubectl binary.
+	KubeClient string
+	// HealthNamespaces and HealthExcludeNamespaces limit the cluster-wide
+	// pod health checks; entries may be globs like "cattle-*".
+	HealthNamespaces        []string
+	HealthExcludeNamespaces []string
+	// TeardownTimeout bounds how long --destroy waits for the cluster's
+	// Rancher objects and cloud resources to disappear.
+	TeardownTimeout time.Duration
+	// DNSExternalName is the outside name the DNS check resolves from a
+	// pod; it defaults to the Rancher server's hostname.
+	DNSExternalName string
+	// AgentJournal collects the rancher-system-agent journal from every
+	// node on passing runs too; failed runs always collect it.
+	AgentJournal bool
+}
+
+// UsePasswordLogin reports whether the run should log in as a user and mint
+// its own short-lived token instead of using RANCHER_TOKEN.
+func (c *Config) UsePasswordLogin() bool {
+	return c.Token == "" && c.Username != ""
 }
 
 func ReadConfig() (*Config, error) {
@@ -28,9 +81,92 @@ func ReadConfig() (*Config, error) {
 	cfg.Token = os.Getenv("RANCHER_TOKEN")
 	cfg.Provider = os.Getenv("CLOUD_PROVIDER")
 	cfg.K3sUpgradeVersion = os.Getenv("K3S_UPGRADE_VERSION")
+	cfg.Username = os.Getenv("RANCHER_USERNAME")
+	cfg.Password = os.Getenv("RANCHER_PASSWORD")
+	cfg.RunID = os.Getenv("RUN_ID")
+	cfg.ArtifactsDir = os.Getenv("ARTIFACTS_DIR")
+	cfg.TFBackend = os.Getenv("TF_BACKEND")
+	cfg.StateDir = StateDir()
+	cfg.TFBinary = os.Getenv("TF_BINARY")
+	cfg.TFBinaryPath = os.Getenv("TF_BINARY_PATH")
+	cfg.TFBinaryCache = os.Getenv("TF_BINARY_CACHE")
+	cfg.TFVersion = os.Getenv("TF_VERSION")
+	cfg.Owner = os.Getenv("OWNER")
+	cfg.GitCommit = os.Getenv("GIT_COMMIT")
+	cfg.KubeClient = os.Getenv("KUBE_CLIENT")
+	cfg.DNSExternalName = os.Getenv("DNS_EXTERNAL_NAME")
+	cfg.HealthNamespaces = splitList(os.Getenv("HEALTH_NAMESPACES"))
+	cfg.HealthExcludeNamespaces = splitList(os.Getenv("HEALTH_EXCLUDE_NAMESPACES"))
 	if cfg.Provider == "" {
 		cfg.Provider = "digitalocean"
 	}
+	if cfg.TFBinary == "" {
+		cfg.TFBinary = "terraform"
+	}
+	if cfg.ArtifactsDir == "" {
+		cfg.ArtifactsDir = "artifacts"
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = fmt.Sprintf("%s-%04x", time.Now().UTC().Format("20060102-150405"), rand.Intn(0x10000))
+	}
+	if raw := os.Getenv("TF_BACKEND_CONFIG"); raw != "" {
+		backendConfig, err := parseKeyValues(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TF_BACKEND_CONFIG: %w", err)
+		}
+		cfg.TFBackendConfig = backendConfig
+	}
+	cfg.TFRetries = 2
+	if raw := os.Getenv("TF_RETRIES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid TF_RETRIES %q: must be a non-negative integer", raw)
+		}
+		cfg.TFRetries = n
+	}
+	cfg.TFRetryBackoff = 30 * time.Second
+	if raw := os.Getenv("TF_RETRY_BACKOFF"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TF_RETRY_BACKOFF %q: %w", raw, err)
+		}
+		cfg.TFRetryBackoff = d
+	}
+	cfg.ClusterTTL = 24 * time.Hour
+	if raw := os.Getenv("CLUSTER_TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CLUSTER_TTL %q: must be a positive duration", raw)
+		}
+		cfg.ClusterTTL = d
+	}
+	switch cfg.KubeClient {
+	case "", "client-go", "kubectl":
+	default:
+		return nil, fmt.Errorf("invalid KUBE_CLIENT %q: must be client-go or kubectl", cfg.KubeClient)
+	}
+	cfg.TeardownTimeout = 10 * time.Minute
+	if raw := os.Getenv("TEARDOWN_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TEARDOWN_TIMEOUT %q: %w", raw, err)
+		}
+		cfg.TeardownTimeout = d
+	}
+	if raw := os.Getenv("AGENT_JOURNAL"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AGENT_JOURNAL %q: must be true or false", raw)
+		}
+		cfg.AgentJournal = b
+	}
+	if ttl := os.Getenv("RANCHER_TOKEN_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RANCHER_TOKEN_TTL %q: %w", ttl, err)
+		}
+		cfg.TokenTTL = d
+	}
 
 	var missing []string
 
@@ -43,8 +179,11 @@ func ReadConfig() (*Config, error) {
 	if cfg.RancherURL == "" {
 		missing = append(missing, "RANCHER_URL")
 	}
-	if cfg.Token == "" {
-		missing = append(missing, "RANCHER_TOKEN")
+	if cfg.Token == "" && cfg.Username == "" {
+		missing = append(missing, "RANCHER_TOKEN (or RANCHER_USERNAME/RANCHER_PASSWORD)")
+	}
+	if cfg.UsePasswordLogin() && cfg.Password == "" {
+		missing = append(missing, "RANCHER_PASSWORD")
 	}
 
 	if len(missing) > 0 {
@@ -52,3 +191,42 @@ func ReadConfig() (*Config, error) {
 	}
 	return cfg, nil
 }
+
+// StateDir returns the run state directory from STATE_DIR (in the
+// environment or .env), defaulting to .run-state. It is read on its own so
+// state commands work without a full Rancher config.
+func StateDir() string {
+	_ = godotenv.Load()
+	if dir := os.Getenv("STATE_DIR"); dir != "" {
+		return dir
+	}
+	return ".run-state"
+}
+
+// parseKeyValues parses "k1=v1,k2=v2" into a map.
+func parseKeyValues(raw string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return values, nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
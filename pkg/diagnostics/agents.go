@@ -0,0 +1,196 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/kubectl"
+)
+
+// agentPods are the Rancher agents that run as pods in the downstream
+// cluster, keyed by namespace and pod name prefix.
+var agentPods = []struct {
+	Agent     string
+	Namespace string
+	Prefix    string
+}{
+	{"cattle-cluster-agent", "cattle-system", "cattle-cluster-agent-"},
+	{"system-upgrade-controller", "cattle-system", "system-upgrade-controller-"},
+	{"system-agent-upgrader", "cattle-system", "apply-system-agent-upgrader-"},
+	{"fleet-agent", "cattle-fleet-system", "fleet-agent-"},
+}
+
+// systemAgentUnit is rancher-system-agent's systemd unit on every node.
+const systemAgentUnit = "rancher-system-agent"
+
+// agentErrorPatterns are log lines that usually explain provisioning or
+// connectivity problems between Rancher and the downstream cluster.
+var agentErrorPatterns = []struct {
+	Name string
+	Re   *regexp.Regexp
+}{
+	{"certificate", regexp.MustCompile(`(?i)x509:|certificate signed by unknown authority|tls: failed to verify|certificate has expired`)},
+	{"websocket-disconnect", regexp.MustCompile(`(?i)websocket: close|failed to connect to proxy|remotedialer.*(error|clos)|error while proxying`)},
+	{"connection-refused", regexp.MustCompile(`(?i)connection refused`)},
+	{"timeout", regexp.MustCompile(`(?i)i/o timeout|context deadline exceeded|tls handshake timeout`)},
+	{"unauthorized", regexp.MustCompile(`(?i)\b401\b|unauthorized`)},
+	// RBAC denials are routine in agent logs, so they get their own bucket
+	// rather than counting as credential problems.
+	{"forbidden", regexp.MustCompile(`(?i)forbidden`)},
+	{"dns", regexp.MustCompile(`(?i)no such host|server misbehaving`)},
+	{"plan-failure", regexp.MustCompile(`(?i)error applying plan|failed to apply plan|error executing instruction`)},
+}
+
+// AgentLog is the collected log of one agent instance plus what was found in it.
+type AgentLog struct {
+	Agent     string `json:"agent"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Restarts  int    `json:"restarts"`
+	// Findings counts matched lines per error pattern; Examples holds the
+	// first matching line of each.
+	Findings map[string]int    `json:"findings,omitempty"`
+	Examples map[string]string `json:"examples,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	Logs         string `json:"-"`
+	PreviousLogs string `json:"-"`
+}
+
+// CollectAgentLogs pulls the logs of Rancher's agents in the downstream
+// cluster: the agent pods (with --previous when they restarted) and, if
+// journal is set, the rancher-system-agent journal from each node, which
+// takes a privileged pod per node. Failures to read individual agents are
+// recorded on the result rather than aborting the collection.
+func CollectAgentLogs(ctx context.Context, k8s kubectl.Runner, journal bool) []AgentLog {
+	var results []AgentLog
+
+	pods := map[string][]kubectl.PodInfo{}
+	for _, ap := range agentPods {
+		if _, ok := pods[ap.Namespace]; ok {
+			continue
+		}
+		list, err := k8s.ListPods(ctx, ap.Namespace)
+		if err != nil {
+			results = append(results, AgentLog{Agent: ap.Namespace, Namespace: ap.Namespace, Error: err.Error()})
+		}
+		pods[ap.Namespace] = list
+	}
+
+	for _, ap := range agentPods {
+		for _, pod := range pods[ap.Namespace] {
+			if !strings.HasPrefix(pod.Name, ap.Prefix) {
+				continue
+			}
+			log := AgentLog{Agent: ap.Agent, Namespace: ap.Namespace, Pod: pod.Name, Node: pod.Node, Restarts: pod.Restarts}
+			logs, err := k8s.AllLogs(ctx, ap.Namespace, pod.Name, false)
+			if err != nil {
+				log.Error = err.Error()
+			}
+			log.Logs = logs
+			if pod.Restarts > 0 {
+				log.PreviousLogs, _ = k8s.AllLogs(ctx, ap.Namespace, pod.Name, true)
+			}
+			log.scan()
+			results = append(results, log)
+		}
+	}
+
+	if !journal {
+		return results
+	}
+	nodes, err := k8s.GetNodeNames(ctx)
+	if err != nil {
+		results = append(results, AgentLog{Agent: systemAgentUnit, Error: err.Error()})
+	}
+	for _, node := range nodes {
+		log := AgentLog{Agent: systemAgentUnit, Node: node}
+		logs, err := k8s.NodeJournal(ctx, node, systemAgentUnit, 2000)
+		if err != nil {
+			log.Error = err.Error()
+		}
+		log.Logs = logs
+		log.scan()
+		results = append(results, log)
+	}
+
+	return results
+}
+
+func (l *AgentLog) scan() {
+	for _, text := range []string{l.PreviousLogs, l.Logs} {
+		for _, line := range strings.Split(text, "\n") {
+			for _, p := range agentErrorPatterns {
+				if !p.Re.MatchString(line) {
+					continue
+				}
+				if l.Findings == nil {
+					l.Findings = map[string]int{}
+					l.Examples = map[string]string{}
+				}
+				l.Findings[p.Name]++
+				if _, ok := l.Examples[p.Name]; !ok {
+					l.Examples[p.Name] = strings.TrimSpace(line)
+				}
+			}
+		}
+	}
+}
+
+// Source names the agent instance for display, e.g. "fleet-agent (cattle-fleet-system/fleet-agent-abc)".
+func (l *AgentLog) Source() string {
+	switch {
+	case l.Pod != "":
+		return fmt.Sprintf("%s (%s/%s)", l.Agent, l.Namespace, l.Pod)
+	case l.Node != "":
+		return fmt.Sprintf("%s (node %s)", l.Agent, l.Node)
+	default:
+		return l.Agent
+	}
+}
+
+// Summary is a one-line description of the findings, e.g.
+// "restarts=2 certificate=3 timeout=1".
+func (l *AgentLog) Summary() string {
+	parts := []string{fmt.Sprintf("restarts=%d", l.Restarts)}
+	names := make([]string, 0, len(l.Findings))
+	for name := range l.Findings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, l.Findings[name]))
+	}
+	if l.Error != "" {
+		parts = append(parts, "error="+l.Error)
+	}
+	return strings.Join(parts, " ")
+}
+
+// AddAgentLogs stores the collected agent logs in the bundle.
+func (b *Bundle) AddAgentLogs(logs []AgentLog) {
+	for _, l := range logs {
+		var dir string
+		switch {
+		case l.Pod != "":
+			dir = fmt.Sprintf("agents/%s/%s/", l.Namespace, l.Pod)
+		case l.Node != "":
+			dir = fmt.Sprintf("agents/nodes/%s/%s/", l.Node, l.Agent)
+		default:
+			dir = fmt.Sprintf("agents/%s/", l.Agent)
+		}
+		if l.Logs != "" {
+			b.AddString(dir+"logs.txt", l.Logs)
+		}
+		if l.PreviousLogs != "" {
+			b.AddString(dir+"logs-previous.txt", l.PreviousLogs)
+		}
+		if l.Error != "" {
+			b.AddString(dir+"collect.error", l.Error+"\n")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Bundle accumulates redacted diagnostic files in memory and writes them out
+// as a single tarball.
+type Bundle struct {
+	name     string
+	redactor *Redactor
+	files    map[string][]byte
+}
+
+// NewBundle starts an empty bundle. Its name becomes the top-level directory
+// inside the tarball and the tarball's file name.
+func NewBundle(name string, redactor *Redactor) *Bundle {
+	return &Bundle{
+		name:     name,
+		redactor: redactor,
+		files:    map[string][]byte{},
+	}
+}
+
+// Add stores content under path, redacting secrets first.
+func (b *Bundle) Add(path string, content []byte) {
+	b.files[path] = b.redactor.Redact(content)
+}
+
+// AddString is Add for string content.
+func (b *Bundle) AddString(path, content string) {
+	b.Add(path, []byte(content))
+}
+
+// AddResult stores content, or the error that prevented collecting it, so a
+// partially failed collection still explains what is missing.
+func (b *Bundle) AddResult(path string, content []byte, err error) {
+	if err != nil {
+		b.AddString(path+".error", err.Error()+"\n")
+		if len(content) == 0 {
+			return
+		}
+	}
+	b.Add(path, content)
+}
+
+// AddFile copies a file from disk into the bundle.
+func (b *Bundle) AddFile(path, src string) {
+	data, err := os.ReadFile(src)
+	b.AddResult(path, data, err)
+}
+
+// Write saves the bundle as <dir>/<name>.tar.gz and returns its path.
+func (b *Bundle) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create artifacts dir: %w", err)
+	}
+
+	path := filepath.Join(dir, b.name+".tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("create bundle: %w", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(b.files))
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		content := b.files[name]
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(filepath.Join(b.name, name)),
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", fmt.Errorf("write bundle: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return "", fmt.Errorf("write bundle: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("write bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("write bundle: %w", err)
+	}
+	return path, nil
+}
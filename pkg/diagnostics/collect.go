@@ -0,0 +1,97 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/kubectl"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/rancher"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/terraform"
+)
+
+// Sources is what a failed run had set up by the time it failed. Any field
+// may be nil or empty; the collector skips what is not available.
+type Sources struct {
+	Kubectl     kubectl.Runner
+	Rancher     *rancher.Client
+	Terraform   *terraform.Runner
+	ClusterID   string
+	ClusterName string
+	// AgentLogs are Rancher agent logs already collected by CollectAgentLogs.
+	AgentLogs []AgentLog
+}
+
+// Collect gathers everything useful for debugging a failed run into a
+// redacted tarball under artifactsDir and returns its path.
+func Collect(ctx context.Context, src *Sources, artifactsDir, name string, redactor *Redactor) (string, error) {
+	b := NewBundle(name, redactor)
+
+	if src.Kubectl != nil {
+		collectKubernetes(ctx, b, src.Kubectl)
+	}
+	b.AddAgentLogs(src.AgentLogs)
+	if src.Rancher != nil {
+		collectRancher(b, src)
+	}
+	if src.Terraform != nil {
+		out, err := src.Terraform.OutputText()
+		b.AddResult("terraform/output.txt", []byte(out), err)
+		if src.Terraform.LastLog != "" {
+			b.AddFile("terraform/"+filepath.Base(src.Terraform.LastLog), src.Terraform.LastLog)
+		}
+	}
+
+	return b.Write(artifactsDir)
+}
+
+func collectKubernetes(ctx context.Context, b *Bundle, k8s kubectl.Runner) {
+	all, err := k8s.GetAll(ctx)
+	b.AddResult("kubernetes/get-all.txt", []byte(all), err)
+
+	events, err := k8s.GetEvents(ctx)
+	b.AddResult("kubernetes/events.txt", []byte(events), err)
+
+	nodes, err := k8s.Describe(ctx, "nodes", "", "")
+	b.AddResult("kubernetes/nodes.txt", []byte(nodes), err)
+
+	unhealthy, err := k8s.GetAllUnhealthyPods(ctx, kubectl.PodFilter{})
+	if err != nil {
+		b.AddResult("kubernetes/unhealthy-pods.txt", nil, err)
+		return
+	}
+	var table strings.Builder
+	kubectl.WriteUnhealthyPods(&table, unhealthy)
+	b.AddString("kubernetes/unhealthy-pods.txt", table.String())
+
+	for _, p := range unhealthy {
+		namespace, pod := p.Namespace, p.Name
+		dir := fmt.Sprintf("kubernetes/pods/%s/%s/", namespace, pod)
+
+		desc, err := k8s.Describe(ctx, "pod", namespace, pod)
+		b.AddResult(dir+"describe.txt", []byte(desc), err)
+
+		logs, err := k8s.AllLogs(ctx, namespace, pod, false)
+		b.AddResult(dir+"logs.txt", []byte(logs), err)
+
+		// Only restarted containers have previous logs; the error is expected otherwise.
+		if prev, err := k8s.AllLogs(ctx, namespace, pod, true); err == nil {
+			b.AddString(dir+"logs-previous.txt", prev)
+		}
+	}
+}
+
+func collectRancher(b *Bundle, src *Sources) {
+	if src.ClusterID != "" {
+		data, err := src.Rancher.RawCluster(src.ClusterID)
+		b.AddResult("rancher/cluster-v3.json", data, err)
+	}
+	if src.ClusterName != "" {
+		data, err := src.Rancher.RawProvisioningCluster(src.ClusterName)
+		b.AddResult("rancher/cluster-provisioning.json", data, err)
+
+		data, err = src.Rancher.RawMachines(src.ClusterName)
+		b.AddResult("rancher/machines.json", data, err)
+	}
+}
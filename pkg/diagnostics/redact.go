@@ -0,0 +1,73 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// secretPatterns match secret values in the JSON, YAML, HCL and log output
+// that ends up in a bundle. The first group is kept, the value replaced.
+var secretPatterns = []*regexp.Regexp{
+	// JSON: "token": "...", "accessToken": "...", "client-key-data": "..."
+	regexp.MustCompile(`(?i)("[\w-]*(?:token|password|secret|key-data|certificate-data)"\s*:\s*")(?:[^"\\]|\\.)*`),
+	// YAML / kubeconfig: token: ..., password: ...
+	regexp.MustCompile(`(?im)^(\s*-?\s*[\w-]*(?:token|password|secret|key-data|certificate-data):[ \t]+)\S+`),
+	// tfvars: rancher_token = "...", do_token = "..."
+	regexp.MustCompile(`(?i)(\b\w*(?:token|password|secret)\s*=\s*")[^"]*`),
+	// HTTP auth headers
+	regexp.MustCompile(`(?i)(\b(?:Bearer|Basic)\s+)[A-Za-z0-9._~+/:=-]+`),
+	// Rancher API tokens in <name>:<secret> form
+	regexp.MustCompile(`(\btoken-[a-z0-9]+:)[a-z0-9]{20,}`),
+}
+
+// Redactor scrubs known secret values and secret-looking fields from text.
+type Redactor struct {
+	secrets []string
+}
+
+// NewRedactor returns a Redactor that, in addition to the built-in patterns,
+// replaces every occurrence of the given literal secrets.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	for _, s := range secrets {
+		// Very short values would redact unrelated text.
+		if len(s) >= 8 {
+			r.secrets = append(r.secrets, escapedForms(s)...)
+		}
+	}
+	return r
+}
+
+// escapedForms returns s as it appears inside a JSON or YAML string, and
+// inside a JSON string embedded in another (a provider message in
+// terraform's JSON log), most escaped first so each form is replaced
+// whole. Secrets without quotes or backslashes have only the one form.
+func escapedForms(s string) []string {
+	forms := []string{s}
+	for i := 0; i < 2; i++ {
+		data, _ := json.Marshal(forms[len(forms)-1])
+		escaped := string(data[1 : len(data)-1])
+		if escaped == forms[len(forms)-1] {
+			break
+		}
+		forms = append(forms, escaped)
+	}
+	slices.Reverse(forms)
+	return forms
+}
+
+// Redact returns data with secrets replaced by REDACTED.
+func (r *Redactor) Redact(data []byte) []byte {
+	text := string(data)
+	for _, s := range r.secrets {
+		text = strings.ReplaceAll(text, s, redacted)
+	}
+	for _, p := range secretPatterns {
+		text = p.ReplaceAllString(text, "${1}"+redacted)
+	}
+	return []byte(text)
+}
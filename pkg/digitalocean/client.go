@@ -0,0 +1,165 @@
+// Package digitalocean is a minimal DigitalOcean API client for finding
+// cloud resources a test cluster left behind.
+package digitalocean
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultAPIURL = "https://api.digitalocean.com/v2"
+
+type Client struct {
+	// APIURL is the API base URL, without a trailing slash.
+	APIURL string
+	token  string
+	http   *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		APIURL: defaultAPIURL,
+		token:  token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Resource is a droplet, volume or load balancer.
+type Resource struct {
+	Kind string
+	ID   string
+	Name string
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Kind, r.Name, r.ID)
+}
+
+type droplet struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type volume struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+type loadBalancer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Tag selects the droplets the load balancer forwards to.
+	Tag  string   `json:"tag"`
+	Tags []string `json:"tags"`
+}
+
+// ListTagged returns the droplets, volumes and load balancers carrying tag.
+// Load balancers that target droplets by tag count too.
+func (c *Client) ListTagged(tag string) ([]Resource, error) {
+	var resources []Resource
+
+	droplets, err := listAll[droplet](c, "/droplets?tag_name="+url.QueryEscape(tag), "droplets")
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range droplets {
+		resources = append(resources, Resource{Kind: "droplet", ID: fmt.Sprint(d.ID), Name: d.Name})
+	}
+
+	// Volumes and load balancers can't be filtered by tag server-side.
+	volumes, err := listAll[volume](c, "/volumes", "volumes")
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		if slices.Contains(v.Tags, tag) {
+			resources = append(resources, Resource{Kind: "volume", ID: v.ID, Name: v.Name})
+		}
+	}
+
+	lbs, err := listAll[loadBalancer](c, "/load_balancers", "load_balancers")
+	if err != nil {
+		return nil, err
+	}
+	for _, lb := range lbs {
+		if lb.Tag == tag || slices.Contains(lb.Tags, tag) {
+			resources = append(resources, Resource{Kind: "load balancer", ID: lb.ID, Name: lb.Name})
+		}
+	}
+	return resources, nil
+}
+
+// listAll fetches every page of a collection, whose items are under key.
+func listAll[T any](c *Client, path, key string) ([]T, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	next := c.APIURL + path + sep + "per_page=200"
+
+	var items []T
+	for next != "" {
+		var page map[string]json.RawMessage
+		if err := c.get(next, &page); err != nil {
+			return nil, err
+		}
+		var pageItems []T
+		if raw, ok := page[key]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", key, err)
+			}
+		}
+		items = append(items, pageItems...)
+
+		var links struct {
+			Pages struct {
+				Next string `json:"next"`
+			} `json:"pages"`
+		}
+		next = ""
+		if raw, ok := page["links"]; ok && json.Unmarshal(raw, &links) == nil {
+			next = links.Pages.Next
+		}
+	}
+	return items, nil
+}
+
+func (c *Client) get(url string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("digitalocean API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("digitalocean API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("digitalocean API %s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("digitalocean API %s", resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("parse digitalocean API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package dnscheck verifies cluster DNS from inside a short-lived pod:
+// CoreDNS is running, service names resolve through the pod's search
+// domains, and external names resolve through CoreDNS's upstreams.
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/kubectl"
+)
+
+// image has getent, which resolves through the pod's resolv.conf the way
+// applications do. busybox's nslookup ignores search domains.
+const image = "debian:bookworm-slim"
+
+// script resolves each argument and prints the pod's resolver settings as
+// "resolved <name> <ip> <canonical name>...", "unresolved <name>" and
+// "resolv <nameserver|search|options> <values>..." lines.
+const script = `for name in "$@"; do
+  if entry=$(getent hosts "$name"); then echo "resolved $name $entry"; else echo "unresolved $name"; fi
+done
+while read -r key value || [ -n "$key" ]; do
+  case "$key" in nameserver|search|options) echo "resolv $key $value";; esac
+done < /etc/resolv.conf`
+
+// Options says what to resolve and from where.
+type Options struct {
+	// Namespace the check pod runs in.
+	Namespace string
+	// ClusterDomain defaults to "cluster.local".
+	ClusterDomain string
+	// Services are resolved by their fully qualified names.
+	Services []types.NamespacedName
+	// External is a name outside the cluster; empty skips it.
+	External string
+}
+
+// Lookup is the result of resolving one name.
+type Lookup struct {
+	Name     string
+	Resolved bool
+	Address  string
+	// Names are the canonical name and aliases the resolver returned.
+	Names []string
+}
+
+// Resolver is the pod's /etc/resolv.conf.
+type Resolver struct {
+	Nameservers []string
+	Search      []string
+	Options     []string
+}
+
+// Result is what the check pod saw.
+type Result struct {
+	Lookups  []Lookup
+	Resolver Resolver
+}
+
+// Check waits for the CoreDNS pods, runs the check pod and verifies its
+// lookups and resolver settings, printing what it found.
+func Check(ctx context.Context, k8s kubectl.Runner, opts Options, w io.Writer) (*Result, error) {
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = "cluster.local"
+	}
+
+	// K3s and RKE2 both label their CoreDNS pods like kube-dns.
+	pods, err := k8s.GetPods(ctx, "kube-system", "k8s-app=kube-dns")
+	if err != nil {
+		return nil, fmt.Errorf("cluster DNS: %w", err)
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("cluster DNS: no CoreDNS pods (k8s-app=kube-dns) in kube-system")
+	}
+	for _, pod := range pods {
+		if err := k8s.WaitForPod(ctx, "kube-system", pod); err != nil {
+			return nil, fmt.Errorf("cluster DNS: CoreDNS %w", err)
+		}
+	}
+	fmt.Fprintf(w, "  CoreDNS: %d pod(s) ready\n", len(pods))
+
+	command := append([]string{"sh", "-c", script, "dnscheck"}, names(opts)...)
+	out, err := k8s.RunPod(ctx, opts.Namespace, "dns-check", image, command)
+	if err != nil {
+		return nil, fmt.Errorf("cluster DNS: %w", err)
+	}
+	result, err := parse(out)
+	if err != nil {
+		return nil, fmt.Errorf("cluster DNS: %w", err)
+	}
+
+	for _, l := range result.Lookups {
+		if l.Resolved {
+			fmt.Fprintf(w, "  %s -> %s (%s)\n", l.Name, l.Address, strings.Join(l.Names, ", "))
+		} else {
+			fmt.Fprintf(w, "  %s -> not resolved\n", l.Name)
+		}
+	}
+	fmt.Fprintf(w, "  nameserver %s, search %s, options %s\n", strings.Join(result.Resolver.Nameservers, " "),
+		strings.Join(result.Resolver.Search, " "), strings.Join(result.Resolver.Options, " "))
+
+	if problems := verify(result, opts); len(problems) > 0 {
+		return result, fmt.Errorf("cluster DNS: %s", strings.Join(problems, "; "))
+	}
+	return result, nil
+}
+
+// names lists what the check pod resolves. kubernetes.default only
+// resolves through the search domains; the others are fully qualified.
+func names(opts Options) []string {
+	names := []string{"kubernetes.default"}
+	for _, svc := range opts.Services {
+		names = append(names, fmt.Sprintf("%s.%s.svc.%s.", svc.Name, svc.Namespace, opts.ClusterDomain))
+	}
+	if opts.External != "" {
+		names = append(names, strings.TrimSuffix(opts.External, ".")+".")
+	}
+	return names
+}
+
+// parse reads the check pod's output.
+func parse(out string) (*Result, error) {
+	result := &Result{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "resolved":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("unexpected check output %q", line)
+			}
+			result.Lookups = append(result.Lookups, Lookup{Name: fields[1], Resolved: true, Address: fields[2], Names: fields[3:]})
+		case "unresolved":
+			result.Lookups = append(result.Lookups, Lookup{Name: fields[1]})
+		case "resolv":
+			switch fields[1] {
+			case "nameserver":
+				result.Resolver.Nameservers = append(result.Resolver.Nameservers, fields[2:]...)
+			case "search":
+				result.Resolver.Search = append(result.Resolver.Search, fields[2:]...)
+			case "options":
+				result.Resolver.Options = append(result.Resolver.Options, fields[2:]...)
+			}
+		}
+	}
+	if len(result.Lookups) == 0 {
+		return nil, fmt.Errorf("unexpected check output %q", out)
+	}
+	return result, nil
+}
+
+// verify lists what is wrong with the pod's DNS.
+func verify(result *Result, opts Options) []string {
+	var problems []string
+	for _, l := range result.Lookups {
+		if !l.Resolved {
+			problems = append(problems, "could not resolve "+l.Name)
+		}
+	}
+	if l := result.Lookups[0]; l.Resolved {
+		want := "kubernetes.default.svc." + opts.ClusterDomain
+		if !slices.Contains(l.Names, want) {
+			problems = append(problems, fmt.Sprintf("kubernetes.default resolved to %s, want %s", strings.Join(l.Names, ", "), want))
+		}
+	}
+
+	r := result.Resolver
+	if len(r.Nameservers) == 0 {
+		problems = append(problems, "no nameserver in resolv.conf")
+	}
+	for _, domain := range []string{opts.Namespace + ".svc." + opts.ClusterDomain, "svc." + opts.ClusterDomain, opts.ClusterDomain} {
+		if !slices.Contains(r.Search, domain) {
+			problems = append(problems, fmt.Sprintf("search domain %s missing from resolv.conf", domain))
+		}
+	}
+	if !slices.Contains(r.Options, "ndots:5") {
+		problems = append(problems, fmt.Sprintf("resolv.conf options %q lack ndots:5", strings.Join(r.Options, " ")))
+	}
+	return problems
+}
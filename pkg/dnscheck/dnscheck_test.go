@@ -0,0 +1,161 @@
+package dnscheck
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// podOutput is the check script's output in a default K3s pod. getent
+// prints one line per address, so the external name spans three lines.
+const podOutput = `resolved kubernetes.default 10.43.0.1       kubernetes.default.svc.cluster.local
+resolved nginx.default.svc.cluster.local. 10.43.112.9     nginx.default.svc.cluster.local
+resolved example.com. 2606:2800:21f:cb07:6820:80da:af6b:8b2c example.com
+2600:1406:3a00:21::173e:2e65 example.com
+2600:1406:bc00:53::b81e:94ce example.com
+resolv search default.svc.cluster.local svc.cluster.local cluster.local
+resolv nameserver 10.43.0.10
+resolv options ndots:5
+`
+
+var testOpts = Options{
+	Namespace:     "default",
+	ClusterDomain: "cluster.local",
+	Services:      []types.NamespacedName{{Namespace: "default", Name: "nginx"}},
+	External:      "example.com",
+}
+
+func TestParse(t *testing.T) {
+	result, err := parse(podOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Lookup{
+		{Name: "kubernetes.default", Resolved: true, Address: "10.43.0.1", Names: []string{"kubernetes.default.svc.cluster.local"}},
+		{Name: "nginx.default.svc.cluster.local.", Resolved: true, Address: "10.43.112.9", Names: []string{"nginx.default.svc.cluster.local"}},
+		{Name: "example.com.", Resolved: true, Address: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", Names: []string{"example.com"}},
+	}
+	if len(result.Lookups) != len(want) {
+		t.Fatalf("got %d lookups, want %d: %+v", len(result.Lookups), len(want), result.Lookups)
+	}
+	for i, l := range result.Lookups {
+		w := want[i]
+		if l.Name != w.Name || l.Resolved != w.Resolved || l.Address != w.Address || !slices.Equal(l.Names, w.Names) {
+			t.Errorf("lookup %d = %+v, want %+v", i, l, w)
+		}
+	}
+
+	r := result.Resolver
+	if !slices.Equal(r.Nameservers, []string{"10.43.0.10"}) ||
+		!slices.Equal(r.Search, []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}) ||
+		!slices.Equal(r.Options, []string{"ndots:5"}) {
+		t.Errorf("resolver = %+v", r)
+	}
+	if problems := verify(result, testOpts); len(problems) > 0 {
+		t.Errorf("verify = %q, want no problems", problems)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, out := range []string{"", "sh: getent: not found\n", "resolved kubernetes.default\n", "resolv nameserver 10.43.0.10\n"} {
+		if _, err := parse(out); err == nil {
+			t.Errorf("parse(%q) = nil error", out)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(string) string
+		opts Options
+		want []string
+	}{
+		{
+			name: "unresolved service",
+			edit: func(out string) string {
+				return strings.Replace(out, "resolved nginx.default.svc.cluster.local. 10.43.112.9     nginx.default.svc.cluster.local",
+					"unresolved nginx.default.svc.cluster.local.", 1)
+			},
+			want: []string{"could not resolve nginx.default.svc.cluster.local."},
+		},
+		{
+			name: "unresolved kubernetes.default",
+			edit: func(out string) string {
+				return strings.Replace(out, "resolved kubernetes.default 10.43.0.1       kubernetes.default.svc.cluster.local",
+					"unresolved kubernetes.default", 1)
+			},
+			want: []string{"could not resolve kubernetes.default"},
+		},
+		{
+			name: "kubernetes.default from another domain",
+			edit: func(out string) string {
+				return strings.Replace(out, "kubernetes.default.svc.cluster.local\n", "kubernetes.default.corp.example\n", 1)
+			},
+			want: []string{"kubernetes.default resolved to kubernetes.default.corp.example, want kubernetes.default.svc.cluster.local"},
+		},
+		{
+			name: "missing search domain",
+			edit: func(out string) string {
+				return strings.Replace(out, "resolv search default.svc.cluster.local svc.cluster.local cluster.local",
+					"resolv search svc.cluster.local cluster.local", 1)
+			},
+			want: []string{"search domain default.svc.cluster.local missing from resolv.conf"},
+		},
+		{
+			name: "other namespace",
+			opts: Options{Namespace: "dns-test"},
+			want: []string{"search domain dns-test.svc.cluster.local missing from resolv.conf"},
+		},
+		{
+			name: "missing ndots",
+			edit: func(out string) string {
+				return strings.Replace(out, "resolv options ndots:5", "resolv options ndots:1 edns0", 1)
+			},
+			want: []string{`resolv.conf options "ndots:1 edns0" lack ndots:5`},
+		},
+		{
+			name: "no options or nameserver",
+			edit: func(out string) string {
+				out = strings.Replace(out, "resolv options ndots:5\n", "", 1)
+				return strings.Replace(out, "resolv nameserver 10.43.0.10\n", "", 1)
+			},
+			want: []string{"no nameserver in resolv.conf", `resolv.conf options "" lack ndots:5`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := podOutput
+			if tt.edit != nil {
+				out = tt.edit(out)
+			}
+			opts := testOpts
+			if tt.opts.Namespace != "" {
+				opts.Namespace = tt.opts.Namespace
+			}
+			result, err := parse(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := verify(result, opts); !slices.Equal(got, tt.want) {
+				t.Errorf("verify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	got := names(Options{
+		ClusterDomain: "cluster.local",
+		Services:      []types.NamespacedName{{Namespace: "web", Name: "nginx"}},
+		External:      "example.com.",
+	})
+	want := []string{"kubernetes.default", "nginx.web.svc.cluster.local.", "example.com."}
+	if !slices.Equal(got, want) {
+		t.Errorf("names = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,883 @@
+package kubectl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldManager owns the fields this tool sets with server-side apply.
+const fieldManager = "hosted-rancher-testing"
+
+// ClientRunner implements Runner with client-go, talking to the API server
+// through the kubeconfig's (Rancher-proxied) endpoint. It needs no kubectl
+// binary.
+type ClientRunner struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// NewClientRunner builds clients from the kubeconfig content.
+func NewClientRunner(kubeconfigContent string) (*ClientRunner, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigContent))
+	if err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create kubernetes client: %w", err)
+	}
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+	return &ClientRunner{
+		config:    config,
+		clientset: clientset,
+		dynamic:   dyn,
+		mapper:    restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}, nil
+}
+
+// Apply server-side applies every object in a YAML or JSON manifest, in
+// file order.
+func (r *ClientRunner) Apply(ctx context.Context, manifestPath string) error {
+	objects, err := readManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("apply failed: %w", err)
+	}
+	for _, obj := range objects {
+		res, err := r.resource(obj.GroupVersionKind(), obj.GetNamespace())
+		if err != nil {
+			return fmt.Errorf("apply failed: %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		if _, err := res.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+			return fmt.Errorf("apply failed: %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// Delete removes a manifest's objects in reverse order, ignoring ones
+// that are already gone. It does not wait for finalizers.
+func (r *ClientRunner) Delete(ctx context.Context, manifestPath string) error {
+	objects, err := readManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	propagation := metav1.DeletePropagationForeground
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		res, err := r.resource(obj.GroupVersionKind(), obj.GetNamespace())
+		if err != nil {
+			return fmt.Errorf("delete failed: %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		err = res.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete failed: %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// readManifest decodes the objects of a multi-document YAML or JSON file,
+// expanding List kinds.
+func readManifest(path string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		err := decoder.Decode(&obj.Object)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if !obj.IsList() {
+			objects = append(objects, obj)
+			continue
+		}
+		err = obj.EachListItem(func(item runtime.Object) error {
+			objects = append(objects, item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+}
+
+// resource returns the dynamic client for a kind, defaulting the namespace
+// of namespaced kinds.
+func (r *ClientRunner) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// The kind may come from a CRD created since discovery was cached.
+		r.mapper.Reset()
+		mapping, err = r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return r.dynamic.Resource(mapping.Resource), nil
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return r.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// GetAllUnhealthyPods diagnoses the pods NOT in Running/Succeeded phase OR
+// Running but not Ready, in the namespaces the filter selects.
+func (r *ClientRunner) GetAllUnhealthyPods(ctx context.Context, filter PodFilter) ([]UnhealthyPod, error) {
+	pods, err := r.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get pods failed: %w", err)
+	}
+	jobs, err := r.clientset.BatchV1().Jobs(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get jobs failed: %w", err)
+	}
+	return diagnosePods(pointers(pods.Items), pointers(jobs.Items), filter, time.Now()), nil
+}
+
+func pointers[T any](items []T) []*T {
+	ptrs := make([]*T, len(items))
+	for i := range items {
+		ptrs[i] = &items[i]
+	}
+	return ptrs
+}
+
+func findPod(pods []*corev1.Pod, name string) *corev1.Pod {
+	for _, pod := range pods {
+		if pod.Name == name {
+			return pod
+		}
+	}
+	return nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// GetPods returns the names of the pods matching a label selector.
+func (r *ClientRunner) GetPods(ctx context.Context, namespace, labelSelector string) ([]string, error) {
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("get pods failed: %w", err)
+	}
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	return names, nil
+}
+
+// WaitForPod waits for a pod's Ready condition, watching it through a
+// shared informer.
+func (r *ClientRunner) WaitForPod(ctx context.Context, namespace, podName string) error {
+	var last *corev1.Pod
+	err := r.waitForPods(ctx, namespace, fields.OneTermEqualSelector("metadata.name", podName), func(pods []*corev1.Pod, _ []*batchv1.Job) bool {
+		last = findPod(pods, podName)
+		return last != nil && podReady(last)
+	})
+	if err != nil {
+		if last == nil {
+			return fmt.Errorf("wait failed: pod %s/%s not found: %w", namespace, podName, err)
+		}
+		return fmt.Errorf("wait failed: pod %s/%s is %s and not ready: %w", namespace, podName, last.Status.Phase, err)
+	}
+	return nil
+}
+
+// WaitForAllPodsReady waits until no pod the filter selects is unhealthy,
+// re-checking whenever a pod or job changes. On timeout it returns a
+// *NotReadyError.
+func (r *ClientRunner) WaitForAllPodsReady(ctx context.Context, filter PodFilter) error {
+	var unhealthy []UnhealthyPod
+	err := r.waitForPods(ctx, metav1.NamespaceAll, nil, func(pods []*corev1.Pod, jobs []*batchv1.Job) bool {
+		unhealthy = diagnosePods(pods, jobs, filter, time.Now())
+		return len(unhealthy) == 0
+	})
+	if err != nil && ctx.Err() != nil && unhealthy != nil {
+		return &NotReadyError{Pods: unhealthy}
+	}
+	return err
+}
+
+// WaitForRollouts waits until every workload has completed its rollout.
+func (r *ClientRunner) WaitForRollouts(ctx context.Context, workloads []Workload) error {
+	return waitForRollouts(ctx, workloads, 2*time.Second, func(ctx context.Context, w Workload) (*unstructured.Unstructured, error) {
+		res, err := r.resource(w.gvk(), w.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		return res.Get(ctx, w.Name, metav1.GetOptions{})
+	})
+}
+
+// waitForPods runs shared pod and job informers for the namespace (all if
+// empty) and calls done with the cached objects on every change until it
+// returns true or ctx ends. A field selector narrows the pods; jobs are
+// then not watched.
+func (r *ClientRunner) waitForPods(ctx context.Context, namespace string, selector fields.Selector, done func([]*corev1.Pod, []*batchv1.Job) bool) error {
+	opts := []informers.SharedInformerOption{informers.WithNamespace(namespace)}
+	if selector != nil {
+		opts = append(opts, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = selector.String()
+		}))
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(r.clientset, 0, opts...)
+	pods := factory.Core().V1().Pods()
+	informerList := []cache.SharedIndexInformer{pods.Informer()}
+	var jobLister batchlisters.JobLister
+	if selector == nil {
+		jobs := factory.Batch().V1().Jobs()
+		jobLister = jobs.Lister()
+		informerList = append(informerList, jobs.Informer())
+	}
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	synced := make([]cache.InformerSynced, 0, len(informerList))
+	for _, informer := range informerList {
+		if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { notify() },
+			UpdateFunc: func(interface{}, interface{}) { notify() },
+			DeleteFunc: func(interface{}) { notify() },
+		}); err != nil {
+			return err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		factory.Shutdown()
+	}()
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("pod cache never synced: %w", ctx.Err())
+	}
+
+	for {
+		podList, err := pods.Lister().List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		var jobList []*batchv1.Job
+		if jobLister != nil {
+			if jobList, err = jobLister.List(labels.Everything()); err != nil {
+				return err
+			}
+		}
+		if done(podList, jobList) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Logs returns the last tailLines lines of a pod's logs.
+func (r *ClientRunner) Logs(ctx context.Context, namespace, podName string, tailLines int) (string, error) {
+	tail := int64(tailLines)
+	data, err := r.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{TailLines: &tail}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("logs failed: %w", err)
+	}
+	return string(data), nil
+}
+
+// Exec runs a command in a pod's default container and returns its stdout.
+// Like kubectl it tries a WebSocket connection first and falls back to SPDY.
+func (r *ClientRunner) Exec(ctx context.Context, namespace, podName string, command []string) (string, error) {
+	req := r.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(podName).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{Command: command, Stdout: true, Stderr: true}, scheme.ParameterCodec)
+
+	spdy, err := remotecommand.NewSPDYExecutor(r.config, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("exec failed: %w", err)
+	}
+	ws, err := remotecommand.NewWebSocketExecutor(r.config, "GET", req.URL().String())
+	if err != nil {
+		return "", fmt.Errorf("exec failed: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(ws, spdy, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return "", fmt.Errorf("exec failed: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return "", fmt.Errorf("exec failed: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.String(), nil
+}
+
+// PortForward forwards a local port to a pod, or to a ready pod behind a
+// service, over WebSocket, falling back to SPDY like Exec.
+func (r *ClientRunner) PortForward(ctx context.Context, namespace, target string, port int) (*Forward, error) {
+	kind, name, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	pod, podPort := name, port
+	if kind == "service" {
+		svc, err := r.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("port-forward failed: %w", err)
+		}
+		pods, err := r.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("port-forward failed: %w", err)
+		}
+		if pod, podPort, err = servicePod(svc, pointers(pods.Items), port); err != nil {
+			return nil, fmt.Errorf("port-forward failed: %w", err)
+		}
+	}
+
+	req := r.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward")
+	transport, upgrader, err := spdy.RoundTripperFor(r.config)
+	if err != nil {
+		return nil, fmt.Errorf("port-forward failed: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+	tunnel, err := portforward.NewSPDYOverWebsocketDialer(req.URL(), r.config)
+	if err != nil {
+		return nil, fmt.Errorf("port-forward failed: %w", err)
+	}
+	dialer = portforward.NewFallbackDialer(tunnel, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	stopCh, readyCh, errCh := make(chan struct{}), make(chan struct{}), make(chan error, 1)
+	var errOut bytes.Buffer
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", podPort)}, stopCh, readyCh, io.Discard, &errOut)
+	if err != nil {
+		return nil, fmt.Errorf("port-forward failed: %w", err)
+	}
+	go func() { errCh <- fw.ForwardPorts() }()
+
+	forward := &Forward{Pod: pod, stop: func() { close(stopCh) }}
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return nil, fmt.Errorf("port-forward failed: %s: %w", strings.TrimSpace(errOut.String()), err)
+	case <-ctx.Done():
+		forward.Close()
+		return nil, fmt.Errorf("port-forward failed: %w", ctx.Err())
+	}
+	ports, err := fw.GetPorts()
+	if err != nil || len(ports) == 0 {
+		forward.Close()
+		return nil, fmt.Errorf("port-forward failed: no local port: %v", err)
+	}
+	forward.LocalPort = int(ports[0].Local)
+	go func() {
+		select {
+		case <-ctx.Done():
+			forward.Close()
+		case <-stopCh:
+		}
+	}()
+	return forward, nil
+}
+
+// LoadBalancerAddresses reads a Service's or Ingress's load balancer status.
+func (r *ClientRunner) LoadBalancerAddresses(ctx context.Context, kind, namespace, name string) ([]string, error) {
+	gvk, err := loadBalancerGVK(kind)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := res.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get %s %s/%s failed: %w", strings.ToLower(kind), namespace, name, err)
+	}
+	return loadBalancerAddresses(obj), nil
+}
+
+// IngressControllers finds the Traefik or ingress-nginx controllers and
+// the IngressClasses they serve.
+func (r *ClientRunner) IngressControllers(ctx context.Context) ([]IngressController, error) {
+	classes, err := r.clientset.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list ingress classes failed: %w", err)
+	}
+	pods, err := r.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: ingressControllerSelector})
+	if err != nil {
+		return nil, fmt.Errorf("list ingress controller pods failed: %w", err)
+	}
+	return ingressControllers(pointers(classes.Items), pointers(pods.Items)), nil
+}
+
+// GetNodeVersions returns "node=kubeletVersion" for every node.
+func (r *ClientRunner) GetNodeVersions(ctx context.Context) ([]string, error) {
+	nodes, err := r.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get node versions failed: %w", err)
+	}
+	versions := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		versions = append(versions, node.Name+"="+node.Status.NodeInfo.KubeletVersion)
+	}
+	return versions, nil
+}
+
+// GetNodeNames returns the names of all nodes.
+func (r *ClientRunner) GetNodeNames(ctx context.Context) ([]string, error) {
+	nodes, err := r.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get nodes failed: %w", err)
+	}
+	names := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names = append(names, node.Name)
+	}
+	return names, nil
+}
+
+// ListPods returns every pod in a namespace with its node and restart count.
+func (r *ClientRunner) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get pods failed: %w", err)
+	}
+	infos := make([]PodInfo, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		info := PodInfo{Name: pod.Name, Node: pod.Spec.NodeName}
+		for _, cs := range pod.Status.ContainerStatuses {
+			info.Restarts += int(cs.RestartCount)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetAll lists pods, services and workloads in all namespaces, one table
+// per kind, roughly like kubectl get all -A.
+func (r *ClientRunner) GetAll(ctx context.Context) (string, error) {
+	var b bytes.Buffer
+	var errs []error
+	core, apps, batch := r.clientset.CoreV1(), r.clientset.AppsV1(), r.clientset.BatchV1()
+	all := metav1.ListOptions{}
+
+	if pods, err := core.Pods(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tREADY\tSTATUS\tRESTARTS\tAGE\tIP\tNODE", len(pods.Items), func(i int) string {
+			p := &pods.Items[i]
+			ready, restarts := 0, 0
+			for _, cs := range p.Status.ContainerStatuses {
+				if cs.Ready {
+					ready++
+				}
+				restarts += int(cs.RestartCount)
+			}
+			return fmt.Sprintf("%s\tpod/%s\t%d/%d\t%s\t%d\t%s\t%s\t%s", p.Namespace, p.Name, ready, len(p.Spec.Containers),
+				podStatus(p), restarts, age(p.CreationTimestamp), dash(p.Status.PodIP), dash(p.Spec.NodeName))
+		})
+	}
+	if svcs, err := core.Services(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tTYPE\tCLUSTER-IP\tPORTS\tAGE", len(svcs.Items), func(i int) string {
+			s := &svcs.Items[i]
+			var ports []string
+			for _, p := range s.Spec.Ports {
+				ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+			}
+			return fmt.Sprintf("%s\tservice/%s\t%s\t%s\t%s\t%s", s.Namespace, s.Name, s.Spec.Type, dash(s.Spec.ClusterIP),
+				dash(strings.Join(ports, ",")), age(s.CreationTimestamp))
+		})
+	}
+	if dss, err := apps.DaemonSets(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tDESIRED\tREADY\tUP-TO-DATE\tAVAILABLE\tAGE", len(dss.Items), func(i int) string {
+			d := &dss.Items[i]
+			return fmt.Sprintf("%s\tdaemonset.apps/%s\t%d\t%d\t%d\t%d\t%s", d.Namespace, d.Name, d.Status.DesiredNumberScheduled,
+				d.Status.NumberReady, d.Status.UpdatedNumberScheduled, d.Status.NumberAvailable, age(d.CreationTimestamp))
+		})
+	}
+	if deps, err := apps.Deployments(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tREADY\tUP-TO-DATE\tAVAILABLE\tAGE", len(deps.Items), func(i int) string {
+			d := &deps.Items[i]
+			return fmt.Sprintf("%s\tdeployment.apps/%s\t%d/%d\t%d\t%d\t%s", d.Namespace, d.Name, d.Status.ReadyReplicas,
+				ptr.Deref(d.Spec.Replicas, 1), d.Status.UpdatedReplicas, d.Status.AvailableReplicas, age(d.CreationTimestamp))
+		})
+	}
+	if rss, err := apps.ReplicaSets(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tDESIRED\tCURRENT\tREADY\tAGE", len(rss.Items), func(i int) string {
+			rs := &rss.Items[i]
+			return fmt.Sprintf("%s\treplicaset.apps/%s\t%d\t%d\t%d\t%s", rs.Namespace, rs.Name, ptr.Deref(rs.Spec.Replicas, 1),
+				rs.Status.Replicas, rs.Status.ReadyReplicas, age(rs.CreationTimestamp))
+		})
+	}
+	if stss, err := apps.StatefulSets(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tREADY\tAGE", len(stss.Items), func(i int) string {
+			s := &stss.Items[i]
+			return fmt.Sprintf("%s\tstatefulset.apps/%s\t%d/%d\t%s", s.Namespace, s.Name, s.Status.ReadyReplicas,
+				ptr.Deref(s.Spec.Replicas, 1), age(s.CreationTimestamp))
+		})
+	}
+	if jobs, err := batch.Jobs(metav1.NamespaceAll).List(ctx, all); err != nil {
+		errs = append(errs, err)
+	} else {
+		writeTable(&b, "NAMESPACE\tNAME\tCOMPLETIONS\tAGE", len(jobs.Items), func(i int) string {
+			j := &jobs.Items[i]
+			return fmt.Sprintf("%s\tjob.batch/%s\t%d/%d\t%s", j.Namespace, j.Name, j.Status.Succeeded,
+				ptr.Deref(j.Spec.Completions, 1), age(j.CreationTimestamp))
+		})
+	}
+	return b.String(), errors.Join(errs...)
+}
+
+// GetEvents lists events in all namespaces, oldest first.
+func (r *ClientRunner) GetEvents(ctx context.Context) (string, error) {
+	events, err := r.clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("get events failed: %w", err)
+	}
+	var b bytes.Buffer
+	writeEvents(&b, events.Items, true)
+	return b.String(), nil
+}
+
+// Describe prints an object (or every object of the kind when name is
+// empty) as YAML, followed by the object's events. Pass an empty namespace
+// for cluster-scoped kinds.
+func (r *ClientRunner) Describe(ctx context.Context, kind, namespace, name string) (string, error) {
+	gvr, err := r.mapper.ResourceFor(schema.GroupVersionResource{Resource: kind})
+	if err != nil {
+		return "", fmt.Errorf("describe %s: %w", kind, err)
+	}
+	var res dynamic.ResourceInterface = r.dynamic.Resource(gvr)
+	if namespace != "" {
+		res = r.dynamic.Resource(gvr).Namespace(namespace)
+	}
+
+	var objects []unstructured.Unstructured
+	if name != "" {
+		obj, err := res.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("describe %s %s: %w", kind, name, err)
+		}
+		objects = append(objects, *obj)
+	} else {
+		list, err := res.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return "", fmt.Errorf("describe %s: %w", kind, err)
+		}
+		objects = list.Items
+	}
+
+	var b bytes.Buffer
+	for i := range objects {
+		obj := &objects[i]
+		obj.SetManagedFields(nil)
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return b.String(), err
+		}
+		fmt.Fprintf(&b, "--- %s %s\n%s", strings.ToLower(obj.GetKind()), obj.GetName(), data)
+
+		selector := fields.Set{"involvedObject.name": obj.GetName(), "involvedObject.kind": obj.GetKind()}.AsSelector()
+		events, err := r.clientset.CoreV1().Events(obj.GetNamespace()).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+		if err != nil {
+			fmt.Fprintf(&b, "\nEvents: %v\n\n", err)
+			continue
+		}
+		fmt.Fprintln(&b, "\nEvents:")
+		writeEvents(&b, events.Items, false)
+		fmt.Fprintln(&b)
+	}
+	return b.String(), nil
+}
+
+// AllLogs returns the full logs of every container in a pod, each line
+// prefixed with [pod/<pod>/<container>]. With previous set it returns the
+// logs of the last terminated instances instead, failing if there are none.
+func (r *ClientRunner) AllLogs(ctx context.Context, namespace, podName string, previous bool) (string, error) {
+	pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("logs failed: %w", err)
+	}
+
+	var b strings.Builder
+	var errs []error
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		data, err := r.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{Container: c.Name, Previous: previous}).DoRaw(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %w", c.Name, err))
+			continue
+		}
+		prefix := fmt.Sprintf("[pod/%s/%s] ", podName, c.Name)
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			if line != "" {
+				b.WriteString(prefix + line)
+			}
+		}
+	}
+	if len(errs) == len(containers) && len(errs) > 0 {
+		return "", fmt.Errorf("logs failed: %w", errors.Join(errs...))
+	}
+	return b.String(), nil
+}
+
+// NodeJournal reads the last lines of a systemd unit's journal on a node by
+// running a privileged pod on it that chroots into the host, like kubectl
+// debug node. The pod is deleted afterwards.
+func (r *ClientRunner) NodeJournal(ctx context.Context, node, unit string, lines int) (string, error) {
+	prefix := "node-debugger-" + node
+	if len(prefix) > 50 {
+		prefix = prefix[:50]
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: strings.TrimSuffix(prefix, "-") + "-", Namespace: metav1.NamespaceDefault},
+		Spec: corev1.PodSpec{
+			NodeName:      node,
+			HostPID:       true,
+			HostNetwork:   true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:            "debugger",
+				Image:           "busybox",
+				Command:         []string{"chroot", "/host", "journalctl", "-u", unit, "--no-pager", "-n", strconv.Itoa(lines)},
+				SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)},
+				VolumeMounts:    []corev1.VolumeMount{{Name: "host-root", MountPath: "/host"}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name:         "host-root",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/"}},
+			}},
+		},
+	}
+
+	out, err := r.runPod(ctx, pod)
+	if err != nil {
+		return out, fmt.Errorf("journal for %s on %s failed: %w", unit, node, err)
+	}
+	return out, nil
+}
+
+// RunPod runs command in a short-lived pod and returns its output.
+func (r *ClientRunner) RunPod(ctx context.Context, namespace, namePrefix, image string, command []string) (string, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: namePrefix + "-", Namespace: namespace},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: ptr.To(int64(1)),
+			Containers: []corev1.Container{{
+				Name:    "run",
+				Image:   image,
+				Command: command,
+			}},
+		},
+	}
+	out, err := r.runPod(ctx, pod)
+	if err != nil {
+		return out, fmt.Errorf("run pod failed: %w", err)
+	}
+	return out, nil
+}
+
+// runPod creates a pod, waits for it to finish and returns its logs,
+// deleting it afterwards. A failed pod's logs are returned with the error.
+func (r *ClientRunner) runPod(ctx context.Context, pod *corev1.Pod) (string, error) {
+	pods := r.clientset.CoreV1().Pods(pod.Namespace)
+	created, err := pods.Create(ctx, pod, metav1.CreateOptions{FieldManager: fieldManager})
+	if err != nil {
+		return "", err
+	}
+	defer pods.Delete(context.Background(), created.Name, metav1.DeleteOptions{})
+
+	var phase corev1.PodPhase
+	err = r.waitForPods(ctx, pod.Namespace, fields.OneTermEqualSelector("metadata.name", created.Name), func(list []*corev1.Pod, _ []*batchv1.Job) bool {
+		if pod := findPod(list, created.Name); pod != nil {
+			phase = pod.Status.Phase
+		}
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed
+	})
+	if err != nil {
+		return "", fmt.Errorf("pod %s/%s: %w", pod.Namespace, created.Name, err)
+	}
+
+	data, err := pods.GetLogs(created.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	if phase == corev1.PodFailed {
+		return string(data), fmt.Errorf("pod %s/%s exited with an error", pod.Namespace, created.Name)
+	}
+	return string(data), nil
+}
+
+// Cleanup is a no-op; ClientRunner keeps no temporary files.
+func (r *ClientRunner) Cleanup() error {
+	return nil
+}
+
+// podStatus is the waiting or terminated reason of the first unhappy
+// container, else the pod phase, like kubectl's STATUS column.
+func podStatus(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return cs.State.Waiting.Reason
+		}
+		if cs.State.Terminated != nil && cs.State.Terminated.Reason != "" && pod.Status.Phase == corev1.PodRunning {
+			return cs.State.Terminated.Reason
+		}
+	}
+	return string(pod.Status.Phase)
+}
+
+func writeTable(w io.Writer, header string, n int, row func(i int) string) {
+	if n == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(tw, row(i))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+func writeEvents(w io.Writer, events []corev1.Event, withNamespace bool) {
+	sort.SliceStable(events, func(i, j int) bool { return eventTime(&events[i]).Before(eventTime(&events[j])) })
+	if len(events) == 0 {
+		fmt.Fprintln(w, "<none>")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := "LAST SEEN\tTYPE\tREASON\tOBJECT\tMESSAGE"
+	if withNamespace {
+		header = "NAMESPACE\t" + header
+	}
+	fmt.Fprintln(tw, header)
+	for i := range events {
+		e := &events[i]
+		row := fmt.Sprintf("%s\t%s\t%s\t%s/%s\t%s", age(metav1.NewTime(eventTime(e))), e.Type, e.Reason,
+			strings.ToLower(e.InvolvedObject.Kind), e.InvolvedObject.Name, strings.TrimSpace(e.Message))
+		if withNamespace {
+			row = e.Namespace + "\t" + row
+		}
+		fmt.Fprintln(tw, row)
+	}
+	tw.Flush()
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
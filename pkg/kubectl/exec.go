@@ -0,0 +1,450 @@
+package kubectl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ExecRunner implements Runner by shelling out to the kubectl binary.
+type ExecRunner struct {
+	kubeconfigPath string
+	kubectlBin     string
+}
+
+// NewExecRunner initializes the runner and verifies kubectl exists to avoid 127 errors.
+func NewExecRunner(kubeconfigContent string) (*ExecRunner, error) {
+	// 1. Verify kubectl is installed
+	path, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil, fmt.Errorf("kubectl binary not found in PATH: %w", err)
+	}
+
+	// 2. Setup Kubeconfig
+	tempFile, err := os.CreateTemp("", "kubeconfig-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+
+	if _, err := tempFile.Write([]byte(kubeconfigContent)); err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+		return nil, fmt.Errorf("write kubeconfig: %w", err)
+	}
+	_ = tempFile.Close()
+
+	return &ExecRunner{
+		kubeconfigPath: tempFile.Name(),
+		kubectlBin:     path,
+	}, nil
+}
+
+// Apply handles manifest application with a standard timeout.
+func (r *ExecRunner) Apply(ctx context.Context, manifestPath string) error {
+	cmd := exec.CommandContext(ctx, r.kubectlBin, "apply", "-f", manifestPath, "--kubeconfig", r.kubeconfigPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("apply failed: %s: %w", stderr.String(), err)
+	}
+	return nil
+}
+
+// Delete removes a manifest's objects without waiting for them to go.
+func (r *ExecRunner) Delete(ctx context.Context, manifestPath string) error {
+	cmd := exec.CommandContext(ctx, r.kubectlBin, "delete", "-f", manifestPath, "--ignore-not-found", "--wait=false", "--kubeconfig", r.kubeconfigPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("delete failed: %s: %w", stderr.String(), err)
+	}
+	return nil
+}
+
+// GetAllUnhealthyPods diagnoses the pods NOT in Running/Succeeded phase OR
+// Running but not Ready, in the namespaces the filter selects.
+func (r *ExecRunner) GetAllUnhealthyPods(ctx context.Context, filter PodFilter) ([]UnhealthyPod, error) {
+	out, err := r.output(ctx, "get", "pods", "-A", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var pods corev1.PodList
+	if err := json.Unmarshal([]byte(out), &pods); err != nil {
+		return nil, fmt.Errorf("parse pods: %w", err)
+	}
+
+	out, err = r.output(ctx, "get", "jobs", "-A", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var jobs batchv1.JobList
+	if err := json.Unmarshal([]byte(out), &jobs); err != nil {
+		return nil, fmt.Errorf("parse jobs: %w", err)
+	}
+	return diagnosePods(pointers(pods.Items), pointers(jobs.Items), filter, time.Now()), nil
+}
+
+// GetPods uses jsonpath to return names safely without "pod/" prefixes.
+func (r *ExecRunner) GetPods(ctx context.Context, namespace, labelSelector string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, r.kubectlBin, "get", "pods", "-n", namespace, "-l", labelSelector, "-o=jsonpath={.items[*].metadata.name}", "--kubeconfig", r.kubeconfigPath)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl get failed: %s: %w", stderr.String(), err)
+	}
+
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return []string{}, nil
+	}
+	return strings.Fields(output), nil
+}
+
+// WaitForPod uses the native kubectl wait logic.
+func (r *ExecRunner) WaitForPod(ctx context.Context, namespace, podName string) error {
+	// Note: timeout is handled by the Go Context
+
+	cmd := exec.CommandContext(ctx, r.kubectlBin, "wait", "--for=condition=ready", "pod/"+podName, "-n", namespace, "--kubeconfig", r.kubeconfigPath)
+	fmt.Printf("cmd: %s", cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wait failed: %s: %w", stderr.String(), err)
+	}
+	return nil
+}
+
+// WaitForAllPodsReady polls until no pod the filter selects is unhealthy.
+// On timeout it returns a *NotReadyError.
+func (r *ExecRunner) WaitForAllPodsReady(ctx context.Context, filter PodFilter) error {
+	var unhealthy []UnhealthyPod
+	for {
+		current, err := r.GetAllUnhealthyPods(ctx, filter)
+		if err != nil {
+			if ctx.Err() != nil && unhealthy != nil {
+				return &NotReadyError{Pods: unhealthy}
+			}
+			return err
+		}
+		if len(current) == 0 {
+			return nil
+		}
+		unhealthy = current
+		select {
+		case <-ctx.Done():
+			return &NotReadyError{Pods: unhealthy}
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// WaitForRollouts polls the workloads with kubectl get until every one has
+// completed its rollout.
+func (r *ExecRunner) WaitForRollouts(ctx context.Context, workloads []Workload) error {
+	return waitForRollouts(ctx, workloads, 5*time.Second, func(ctx context.Context, w Workload) (*unstructured.Unstructured, error) {
+		out, err := r.output(ctx, "get", strings.ToLower(w.Kind)+".apps/"+w.Name, "-n", w.Namespace, "-o", "json")
+		if err != nil {
+			return nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON([]byte(out)); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", w, err)
+		}
+		return obj, nil
+	})
+}
+
+func (r *ExecRunner) Logs(ctx context.Context, namespace, podName string, tailLines int) (string, error) {
+	args := []string{"logs", podName, "-n", namespace, fmt.Sprintf("--tail=%d", tailLines), "--kubeconfig", r.kubeconfigPath}
+	cmd := exec.CommandContext(ctx, r.kubectlBin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("logs failed: %s: %w", stderr.String(), err)
+	}
+	return stdout.String(), nil
+}
+
+// Exec executes a command inside a pod and returns combined output.
+func (r *ExecRunner) Exec(ctx context.Context, namespace, podName string, command []string) (string, error) {
+	args := append([]string{"exec", podName, "-n", namespace, "--kubeconfig", r.kubeconfigPath, "--"}, command...)
+	cmd := exec.CommandContext(ctx, r.kubectlBin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("exec failed: %s: %w", stderr.String(), err)
+	}
+	return stdout.String(), nil
+}
+
+// LoadBalancerAddresses reads a Service's or Ingress's load balancer status.
+func (r *ExecRunner) LoadBalancerAddresses(ctx context.Context, kind, namespace, name string) ([]string, error) {
+	gvk, err := loadBalancerGVK(kind)
+	if err != nil {
+		return nil, err
+	}
+	resource := strings.ToLower(kind)
+	if gvk.Group != "" {
+		resource += "." + gvk.Group
+	}
+	out, err := r.output(ctx, "get", resource+"/"+name, "-n", namespace, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(out)); err != nil {
+		return nil, fmt.Errorf("parse %s %s/%s: %w", resource, namespace, name, err)
+	}
+	return loadBalancerAddresses(obj), nil
+}
+
+// IngressControllers finds the Traefik or ingress-nginx controllers and
+// the IngressClasses they serve.
+func (r *ExecRunner) IngressControllers(ctx context.Context) ([]IngressController, error) {
+	out, err := r.output(ctx, "get", "ingressclasses.networking.k8s.io", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var classes networkingv1.IngressClassList
+	if err := json.Unmarshal([]byte(out), &classes); err != nil {
+		return nil, fmt.Errorf("parse ingress classes: %w", err)
+	}
+	out, err = r.output(ctx, "get", "pods", "-A", "-l", ingressControllerSelector, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var pods corev1.PodList
+	if err := json.Unmarshal([]byte(out), &pods); err != nil {
+		return nil, fmt.Errorf("parse pods: %w", err)
+	}
+	return ingressControllers(pointers(classes.Items), pointers(pods.Items)), nil
+}
+
+// RunPod runs command with kubectl run --attach --rm; its output is the
+// container's.
+func (r *ExecRunner) RunPod(ctx context.Context, namespace, namePrefix, image string, command []string) (string, error) {
+	name := fmt.Sprintf("%s-%05x", namePrefix, rand.Intn(0x100000))
+	args := append([]string{"run", name, "-n", namespace, "--image", image, "--restart=Never", "--attach", "--rm", "--quiet",
+		"--kubeconfig", r.kubeconfigPath, "--command", "--"}, command...)
+	cmd := exec.CommandContext(ctx, r.kubectlBin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// --rm doesn't get to clean up when kubectl is killed on timeout.
+		_, _ = r.output(context.Background(), "delete", "pod", name, "-n", namespace, "--ignore-not-found", "--wait=false")
+		return stdout.String(), fmt.Errorf("run pod failed: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.String(), nil
+}
+
+// forwardingRe matches kubectl port-forward's "Forwarding from
+// 127.0.0.1:43567 -> 80" line.
+var forwardingRe = regexp.MustCompile(`Forwarding from 127\.0\.0\.1:(\d+) ->`)
+
+// PortForward runs kubectl port-forward in the background until the
+// Forward is closed or ctx ends.
+func (r *ExecRunner) PortForward(ctx context.Context, namespace, target string, port int) (*Forward, error) {
+	kind, name, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	fwdCtx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(fwdCtx, r.kubectlBin, "port-forward", "-n", namespace, kind+"/"+name,
+		fmt.Sprintf(":%d", port), "--address", "127.0.0.1", "--kubeconfig", r.kubeconfigPath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("port-forward failed: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("port-forward failed: %w", err)
+	}
+	forward := &Forward{stop: func() {
+		cancel()
+		_ = cmd.Wait()
+	}}
+	if kind == "pod" {
+		forward.Pod = name
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if m := forwardingRe.FindStringSubmatch(scanner.Text()); m != nil {
+			forward.LocalPort, _ = strconv.Atoi(m[1])
+			// Keep draining stdout so kubectl never blocks writing to it.
+			go func() { _, _ = io.Copy(io.Discard, stdout) }()
+			return forward, nil
+		}
+	}
+	forward.Close()
+	return nil, fmt.Errorf("port-forward failed: %s", strings.TrimSpace(stderr.String()))
+}
+
+func (r *ExecRunner) GetNodeVersions(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, r.kubectlBin, "get", "nodes",
+		"-o=jsonpath={range .items[*]}{.metadata.name}={.status.nodeInfo.kubeletVersion}{\"\\n\"}{end}",
+		"--kubeconfig", r.kubeconfigPath)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("get node versions failed: %s: %w", stderr.String(), err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var versions []string
+	for _, line := range lines {
+		if line != "" {
+			versions = append(versions, line)
+		}
+	}
+	return versions, nil
+}
+
+// Cleanup removes the temporary kubeconfig.
+func (r *ExecRunner) Cleanup() error {
+	if r.kubeconfigPath != "" {
+		return os.Remove(r.kubeconfigPath)
+	}
+	return nil
+}
+
+// GetAll lists every workload-level resource in all namespaces (kubectl get all -A).
+func (r *ExecRunner) GetAll(ctx context.Context) (string, error) {
+	return r.output(ctx, "get", "all", "-A", "-o", "wide")
+}
+
+// GetEvents lists events in all namespaces, oldest first.
+func (r *ExecRunner) GetEvents(ctx context.Context) (string, error) {
+	return r.output(ctx, "get", "events", "-A", "--sort-by=.lastTimestamp")
+}
+
+// Describe runs kubectl describe for a single object. Pass an empty
+// namespace for cluster-scoped kinds and an empty name to describe all.
+func (r *ExecRunner) Describe(ctx context.Context, kind, namespace, name string) (string, error) {
+	args := []string{"describe", kind}
+	if name != "" {
+		args = append(args, name)
+	}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	return r.output(ctx, args...)
+}
+
+// AllLogs returns the full logs of every container in a pod. With previous
+// set it returns the logs of the last terminated instance instead.
+func (r *ExecRunner) AllLogs(ctx context.Context, namespace, podName string, previous bool) (string, error) {
+	args := []string{"logs", podName, "-n", namespace, "--all-containers", "--prefix"}
+	if previous {
+		args = append(args, "--previous")
+	}
+	return r.output(ctx, args...)
+}
+
+// ListPods returns every pod in a namespace with its node and restart count.
+func (r *ExecRunner) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
+	format := "-o=jsonpath={range .items[*]}{.metadata.name} {.spec.nodeName} {.status.containerStatuses[*].restartCount}{\"\\n\"}{end}"
+	out, err := r.output(ctx, "get", "pods", "-n", namespace, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []PodInfo
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pod := PodInfo{Name: fields[0], Node: fields[1]}
+		for _, f := range fields[2:] {
+			n, err := strconv.Atoi(f)
+			if err == nil {
+				pod.Restarts += n
+			}
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// GetNodeNames returns the names of all nodes.
+func (r *ExecRunner) GetNodeNames(ctx context.Context) ([]string, error) {
+	out, err := r.output(ctx, "get", "nodes", "-o=jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+var debugPodName = regexp.MustCompile(`Creating debugging pod (\S+)`)
+
+// NodeJournal reads the last lines of a systemd unit's journal on a node by
+// running a privileged debug pod that chroots into the host. The debug pod
+// is deleted afterwards.
+func (r *ExecRunner) NodeJournal(ctx context.Context, node, unit string, lines int) (string, error) {
+	args := []string{"debug", "node/" + node, "-n", "default", "--image=busybox", "--profile=sysadmin", "--attach=true",
+		"--kubeconfig", r.kubeconfigPath,
+		"--", "chroot", "/host", "journalctl", "-u", unit, "--no-pager", "-n", strconv.Itoa(lines)}
+	cmd := exec.CommandContext(ctx, r.kubectlBin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	if m := debugPodName.FindStringSubmatch(stderr.String()); m != nil {
+		_, _ = r.output(context.Background(), "delete", "pod", m[1], "-n", "default", "--wait=false")
+	}
+	if runErr != nil {
+		return stdout.String(), fmt.Errorf("journal for %s on %s failed: %s: %w", unit, node, strings.TrimSpace(stderr.String()), runErr)
+	}
+	return stdout.String(), nil
+}
+
+// output runs kubectl against the runner's kubeconfig and returns stdout.
+func (r *ExecRunner) output(ctx context.Context, args ...string) (string, error) {
+	args = append(args, "--kubeconfig", r.kubeconfigPath)
+	cmd := exec.CommandContext(ctx, r.kubectlBin, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("kubectl %s failed: %s: %w", args[0], strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,120 @@
+package kubectl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ingressControllerSelector finds the pods of the ingress controllers K3s
+// (Traefik) and RKE2 (ingress-nginx) ship, or a separately installed
+// ingress-nginx.
+const ingressControllerSelector = "app.kubernetes.io/name in (traefik,ingress-nginx,rke2-ingress-nginx)"
+
+// ingressClassControllers maps controller pod names to the controller
+// field of the IngressClasses they serve.
+var ingressClassControllers = map[string]string{
+	"traefik":            "traefik.io/ingress-controller",
+	"ingress-nginx":      "k8s.io/ingress-nginx",
+	"rke2-ingress-nginx": "k8s.io/ingress-nginx",
+}
+
+// IngressController is an ingress controller running in the cluster.
+type IngressController struct {
+	Name      string
+	Namespace string
+	Image     string
+	// Version is the image tag, e.g. "3.3.6".
+	Version string
+	// Classes are the IngressClasses it serves; DefaultClass is set when
+	// one of them is the cluster default.
+	Classes      []string
+	DefaultClass bool
+}
+
+func (c IngressController) String() string {
+	s := fmt.Sprintf("%s %s (%s in %s)", c.Name, dash(c.Version), c.Image, c.Namespace)
+	if len(c.Classes) > 0 {
+		s += ", IngressClass " + strings.Join(c.Classes, ", ")
+		if c.DefaultClass {
+			s += " (default)"
+		}
+	}
+	return s
+}
+
+// ingressControllers describes the controllers behind the given pods, one
+// per controller and namespace, using the first running pod's image.
+func ingressControllers(classes []*networkingv1.IngressClass, pods []*corev1.Pod) []IngressController {
+	seen := map[string]bool{}
+	var controllers []IngressController
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	for _, pod := range pods {
+		name := pod.Labels["app.kubernetes.io/name"]
+		key := pod.Namespace + "/" + name
+		if seen[key] || pod.Status.Phase != corev1.PodRunning || len(pod.Spec.Containers) == 0 {
+			continue
+		}
+		seen[key] = true
+
+		c := IngressController{Name: name, Namespace: pod.Namespace, Image: pod.Spec.Containers[0].Image}
+		c.Version = imageTag(c.Image)
+		for _, class := range classes {
+			if class.Spec.Controller != ingressClassControllers[name] {
+				continue
+			}
+			c.Classes = append(c.Classes, class.Name)
+			if class.Annotations[networkingv1.AnnotationIsDefaultIngressClass] == "true" {
+				c.DefaultClass = true
+			}
+		}
+		controllers = append(controllers, c)
+	}
+	return controllers
+}
+
+// imageTag returns the tag of an image reference, or "" when it has none.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		// No tag, or the colon belongs to a registry port.
+		return ""
+	}
+	return image[i+1:]
+}
+
+// loadBalancerGVK is the kind of object LoadBalancerAddresses reads.
+func loadBalancerGVK(kind string) (schema.GroupVersionKind, error) {
+	switch kind {
+	case "Service":
+		return corev1.SchemeGroupVersion.WithKind(kind), nil
+	case "Ingress":
+		return networkingv1.SchemeGroupVersion.WithKind(kind), nil
+	}
+	return schema.GroupVersionKind{}, fmt.Errorf("no load balancer status for kind %s", kind)
+}
+
+// loadBalancerAddresses returns the IPs and hostnames in a Service's or
+// Ingress's status.loadBalancer.
+func loadBalancerAddresses(obj *unstructured.Unstructured) []string {
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	var addresses []string
+	for _, entry := range ingress {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ip, _ := m["ip"].(string); ip != "" {
+			addresses = append(addresses, ip)
+		} else if hostname, _ := m["hostname"].(string); hostname != "" {
+			addresses = append(addresses, hostname)
+		}
+	}
+	return addresses
+}
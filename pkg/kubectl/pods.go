@@ -0,0 +1,246 @@
+package kubectl
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// PodFilter limits pod health checks to some namespaces. Entries are
+// path.Match patterns such as "cattle-*". No Namespaces means all.
+type PodFilter struct {
+	Namespaces        []string
+	ExcludeNamespaces []string
+}
+
+// Match reports whether pods in namespace are checked.
+func (f PodFilter) Match(namespace string) bool {
+	if matchAny(f.ExcludeNamespaces, namespace) {
+		return false
+	}
+	return len(f.Namespaces) == 0 || matchAny(f.Namespaces, namespace)
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// UnhealthyPod says why a pod is not healthy.
+type UnhealthyPod struct {
+	Namespace string
+	Name      string
+	Phase     string
+	// Reason is the pod's main problem, e.g. CrashLoopBackOff, OOMKilled,
+	// Unschedulable or NotReady; pods are grouped by it.
+	Reason string
+	// Containers has one entry per unhappy container, e.g.
+	// "nginx: CrashLoopBackOff (last: OOMKilled, exit 137)".
+	Containers []string
+	Ready      string
+	Restarts   int
+	Node       string
+	OwnerKind  string
+	Age        time.Duration
+}
+
+// Ref is the pod's namespace/name.
+func (p UnhealthyPod) Ref() string {
+	return p.Namespace + "/" + p.Name
+}
+
+// NotReadyError is returned by WaitForAllPodsReady when pods are still
+// unhealthy at the deadline.
+type NotReadyError struct {
+	Pods []UnhealthyPod
+}
+
+func (e *NotReadyError) Error() string {
+	refs := make([]string, 0, len(e.Pods))
+	for _, p := range e.Pods {
+		refs = append(refs, fmt.Sprintf("%s (%s)", p.Ref(), p.Reason))
+	}
+	return fmt.Sprintf("timed out waiting for %d pod(s): %s", len(e.Pods), strings.Join(refs, ", "))
+}
+
+// podUnhealthy is true for pods NOT in Running/Succeeded phase OR Running but not Ready.
+func podUnhealthy(pod *corev1.Pod) bool {
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return false
+	case corev1.PodRunning:
+		for _, cs := range pod.Status.ContainerStatuses {
+			if !cs.Ready {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// diagnosePods returns the unhealthy pods the filter selects, sorted by
+// namespace and name. Pods of completed Jobs are left out: their failed
+// attempts don't matter once the Job has succeeded.
+func diagnosePods(pods []*corev1.Pod, jobs []*batchv1.Job, filter PodFilter, now time.Time) []UnhealthyPod {
+	completed := map[string]bool{}
+	for _, job := range jobs {
+		for _, c := range job.Status.Conditions {
+			if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
+				completed[job.Namespace+"/"+job.Name] = true
+			}
+		}
+	}
+
+	var unhealthy []UnhealthyPod
+	for _, pod := range pods {
+		if !filter.Match(pod.Namespace) || !podUnhealthy(pod) {
+			continue
+		}
+		owner := metav1.GetControllerOf(pod)
+		if owner != nil && owner.Kind == "Job" && completed[pod.Namespace+"/"+owner.Name] {
+			continue
+		}
+		unhealthy = append(unhealthy, diagnosePod(pod, owner, now))
+	}
+	sort.Slice(unhealthy, func(i, j int) bool { return unhealthy[i].Ref() < unhealthy[j].Ref() })
+	return unhealthy
+}
+
+func diagnosePod(pod *corev1.Pod, owner *metav1.OwnerReference, now time.Time) UnhealthyPod {
+	p := UnhealthyPod{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Phase:     string(pod.Status.Phase),
+		Node:      pod.Spec.NodeName,
+	}
+	if owner != nil {
+		p.OwnerKind = owner.Kind
+	}
+	if !pod.CreationTimestamp.IsZero() {
+		p.Age = now.Sub(pod.CreationTimestamp.Time)
+	}
+
+	ready := 0
+	for _, cs := range pod.Status.ContainerStatuses {
+		p.Restarts += int(cs.RestartCount)
+		if cs.Ready {
+			ready++
+		}
+	}
+	p.Ready = fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers))
+
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if reason, detail := containerProblem(cs, true); reason != "" {
+			p.Containers = append(p.Containers, "init:"+cs.Name+": "+detail)
+			if p.Reason == "" {
+				p.Reason = reason
+			}
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if reason, detail := containerProblem(cs, false); reason != "" {
+			p.Containers = append(p.Containers, cs.Name+": "+detail)
+			if p.Reason == "" {
+				p.Reason = reason
+			}
+		}
+	}
+
+	switch {
+	case pod.Status.Reason != "":
+		// Pod-level reasons such as Evicted outrank container state.
+		p.Reason = pod.Status.Reason
+		if pod.Status.Message != "" {
+			p.Containers = append(p.Containers, pod.Status.Message)
+		}
+	case p.Reason != "":
+	default:
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+				p.Reason = c.Reason
+				if c.Message != "" {
+					p.Containers = append(p.Containers, c.Message)
+				}
+			}
+		}
+		if p.Reason == "" {
+			p.Reason = p.Phase
+		}
+	}
+	return p
+}
+
+// containerProblem returns a short reason and a description when a
+// container is unhappy, e.g. "CrashLoopBackOff (last: OOMKilled, exit 137)".
+func containerProblem(cs corev1.ContainerStatus, init bool) (reason, detail string) {
+	last := ""
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		last = fmt.Sprintf(" (last: %s, exit %d)", t.Reason, t.ExitCode)
+	}
+	switch {
+	case cs.State.Waiting != nil:
+		if cs.State.Waiting.Reason == "PodInitializing" || cs.State.Waiting.Reason == "" {
+			return "", ""
+		}
+		detail = cs.State.Waiting.Reason + last
+		if msg := cs.State.Waiting.Message; msg != "" && cs.State.Waiting.Reason != "CrashLoopBackOff" {
+			detail += ": " + msg
+		}
+		return cs.State.Waiting.Reason, detail
+	case cs.State.Terminated != nil:
+		t := cs.State.Terminated
+		if init && t.ExitCode == 0 {
+			return "", ""
+		}
+		return t.Reason, fmt.Sprintf("%s (exit %d)", t.Reason, t.ExitCode)
+	case !init && !cs.Ready:
+		return "NotReady", "not ready" + last
+	}
+	return "", ""
+}
+
+// WriteUnhealthyPods prints unhealthy pods as tables grouped by reason,
+// largest group first.
+func WriteUnhealthyPods(w io.Writer, pods []UnhealthyPod) {
+	groups := map[string][]UnhealthyPod{}
+	for _, p := range pods {
+		groups[p.Reason] = append(groups[p.Reason], p)
+	}
+	reasons := make([]string, 0, len(groups))
+	for reason := range groups {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		a, b := reasons[i], reasons[j]
+		if len(groups[a]) != len(groups[b]) {
+			return len(groups[a]) > len(groups[b])
+		}
+		return a < b
+	})
+
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "\n  %s (%d):\n", reason, len(groups[reason]))
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "    NAMESPACE\tPOD\tPHASE\tREADY\tRESTARTS\tNODE\tOWNER\tAGE\tDETAILS")
+		for _, p := range groups[reason] {
+			fmt.Fprintf(tw, "    %s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", p.Namespace, p.Name, p.Phase, p.Ready, p.Restarts,
+				dash(p.Node), dash(p.OwnerKind), duration.HumanDuration(p.Age), dash(strings.Join(p.Containers, "; ")))
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,265 @@
+package kubectl
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var testNow = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// pod builds a pod created an hour before testNow with one container per
+// status; owner, when set, is "Kind/name".
+func pod(namespace, name, owner string, phase corev1.PodPhase, statuses ...corev1.ContainerStatus) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(testNow.Add(-time.Hour)),
+		},
+		Spec:   corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{Phase: phase, ContainerStatuses: statuses},
+	}
+	for _, cs := range statuses {
+		p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Name: cs.Name})
+	}
+	if kind, ownerName, ok := strings.Cut(owner, "/"); ok {
+		controller := true
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: ownerName, Controller: &controller}}
+	}
+	return p
+}
+
+func ready(name string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+}
+
+func waiting(name, reason, message string, restarts int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+	}
+}
+
+func lastTerminated(cs corev1.ContainerStatus, reason string, exitCode int32) corev1.ContainerStatus {
+	cs.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode}
+	return cs
+}
+
+func job(namespace, name string, condition batchv1.JobConditionType) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: condition, Status: corev1.ConditionTrue},
+		}},
+	}
+}
+
+func TestContainerProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     corev1.ContainerStatus
+		init       bool
+		wantReason string
+		wantDetail string
+	}{
+		{
+			name:   "running and ready",
+			status: ready("app"),
+		},
+		{
+			name:       "running but not ready",
+			status:     lastTerminated(corev1.ContainerStatus{Name: "app", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}, "Error", 1),
+			wantReason: "NotReady",
+			wantDetail: "not ready (last: Error, exit 1)",
+		},
+		{
+			name:       "CrashLoopBackOff after OOMKilled",
+			status:     lastTerminated(waiting("app", "CrashLoopBackOff", "back-off 5m0s restarting failed container", 7), "OOMKilled", 137),
+			wantReason: "CrashLoopBackOff",
+			wantDetail: "CrashLoopBackOff (last: OOMKilled, exit 137)",
+		},
+		{
+			name:       "ImagePullBackOff",
+			status:     waiting("app", "ImagePullBackOff", `Back-off pulling image "nginx:nope"`, 0),
+			wantReason: "ImagePullBackOff",
+			wantDetail: `ImagePullBackOff: Back-off pulling image "nginx:nope"`,
+		},
+		{
+			name: "OOMKilled",
+			status: corev1.ContainerStatus{Name: "app", State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+			}},
+			wantReason: "OOMKilled",
+			wantDetail: "OOMKilled (exit 137)",
+		},
+		{
+			name:   "PodInitializing",
+			status: waiting("app", "PodInitializing", "", 0),
+		},
+		{
+			name: "init container done",
+			status: corev1.ContainerStatus{Name: "setup", State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"},
+			}},
+			init: true,
+		},
+		{
+			name: "init container failed",
+			status: corev1.ContainerStatus{Name: "setup", State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 2},
+			}},
+			init:       true,
+			wantReason: "Error",
+			wantDetail: "Error (exit 2)",
+		},
+		{
+			name:   "init container running",
+			status: corev1.ContainerStatus{Name: "setup", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			init:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, detail := containerProblem(tt.status, tt.init)
+			if reason != tt.wantReason || detail != tt.wantDetail {
+				t.Errorf("containerProblem = %q, %q; want %q, %q", reason, detail, tt.wantReason, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestDiagnosePods(t *testing.T) {
+	crashing := lastTerminated(waiting("app", "CrashLoopBackOff", "back-off", 4), "OOMKilled", 137)
+	pending := pod("default", "unscheduled", "ReplicaSet/web-5d8f", corev1.PodPending)
+	pending.Status.Conditions = []corev1.PodCondition{{
+		Type: corev1.PodScheduled, Status: corev1.ConditionFalse,
+		Reason: "Unschedulable", Message: "0/1 nodes are available: 1 Insufficient cpu.",
+	}}
+	evicted := pod("default", "evicted", "", corev1.PodFailed)
+	evicted.Status.Reason = "Evicted"
+	evicted.Status.Message = "The node was low on resource: memory."
+	initFailed := pod("cattle-system", "init-failed", "", corev1.PodPending, waiting("app", "PodInitializing", "", 0))
+	initFailed.Status.InitContainerStatuses = []corev1.ContainerStatus{lastTerminated(waiting("setup", "CrashLoopBackOff", "", 3), "Error", 1)}
+
+	pods := []*corev1.Pod{
+		pod("default", "healthy", "ReplicaSet/web-5d8f", corev1.PodRunning, ready("app")),
+		pod("default", "done", "", corev1.PodSucceeded),
+		pod("default", "crashing", "ReplicaSet/web-5d8f", corev1.PodRunning, crashing, ready("sidecar")),
+		pod("kube-system", "pull", "DaemonSet/agent", corev1.PodPending, waiting("agent", "ImagePullBackOff", "Back-off pulling image", 0)),
+		pending,
+		evicted,
+		initFailed,
+		pod("cattle-system", "helm-install-abc", "Job/helm-install", corev1.PodFailed,
+			corev1.ContainerStatus{Name: "helm", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}}}),
+		pod("cattle-system", "helm-retry-xyz", "Job/helm-retry", corev1.PodFailed,
+			corev1.ContainerStatus{Name: "helm", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}}}),
+	}
+	jobs := []*batchv1.Job{
+		job("cattle-system", "helm-install", batchv1.JobComplete),
+		job("cattle-system", "helm-retry", batchv1.JobFailed),
+		// A completed Job of the same name elsewhere doesn't hide pods here.
+		job("default", "helm-retry", batchv1.JobComplete),
+	}
+
+	got := diagnosePods(pods, jobs, PodFilter{}, testNow)
+	want := []UnhealthyPod{
+		{
+			Namespace: "cattle-system", Name: "helm-retry-xyz", Phase: "Failed", Reason: "Error",
+			Containers: []string{"helm: Error (exit 1)"}, Ready: "0/1", Node: "node-1", OwnerKind: "Job", Age: time.Hour,
+		},
+		{
+			Namespace: "cattle-system", Name: "init-failed", Phase: "Pending", Reason: "CrashLoopBackOff",
+			Containers: []string{"init:setup: CrashLoopBackOff (last: Error, exit 1)"}, Ready: "0/1", Node: "node-1", Age: time.Hour,
+		},
+		{
+			Namespace: "default", Name: "crashing", Phase: "Running", Reason: "CrashLoopBackOff",
+			Containers: []string{"app: CrashLoopBackOff (last: OOMKilled, exit 137)"}, Ready: "1/2", Restarts: 4,
+			Node: "node-1", OwnerKind: "ReplicaSet", Age: time.Hour,
+		},
+		{
+			Namespace: "default", Name: "evicted", Phase: "Failed", Reason: "Evicted",
+			Containers: []string{"The node was low on resource: memory."}, Ready: "0/0", Node: "node-1", Age: time.Hour,
+		},
+		{
+			Namespace: "default", Name: "unscheduled", Phase: "Pending", Reason: "Unschedulable",
+			Containers: []string{"0/1 nodes are available: 1 Insufficient cpu."}, Ready: "0/0", Node: "node-1",
+			OwnerKind: "ReplicaSet", Age: time.Hour,
+		},
+		{
+			Namespace: "kube-system", Name: "pull", Phase: "Pending", Reason: "ImagePullBackOff",
+			Containers: []string{"agent: ImagePullBackOff: Back-off pulling image"}, Ready: "0/1", Node: "node-1",
+			OwnerKind: "DaemonSet", Age: time.Hour,
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d unhealthy pods, want %d: %v", len(got), len(want), refs(got))
+	}
+	for i := range want {
+		if !equalUnhealthy(got[i], want[i]) {
+			t.Errorf("pod %d:\n  got  %+v\n  want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiagnosePodsFilter(t *testing.T) {
+	broken := func(namespace string) *corev1.Pod {
+		return pod(namespace, "broken", "", corev1.PodPending, waiting("app", "ImagePullBackOff", "", 0))
+	}
+	pods := []*corev1.Pod{broken("default"), broken("cattle-system"), broken("cattle-fleet-system"), broken("kube-system")}
+
+	tests := []struct {
+		name   string
+		filter PodFilter
+		want   []string
+	}{
+		{
+			name: "all",
+			want: []string{"cattle-fleet-system/broken", "cattle-system/broken", "default/broken", "kube-system/broken"},
+		},
+		{
+			name:   "include",
+			filter: PodFilter{Namespaces: []string{"cattle-*"}},
+			want:   []string{"cattle-fleet-system/broken", "cattle-system/broken"},
+		},
+		{
+			name:   "exclude",
+			filter: PodFilter{ExcludeNamespaces: []string{"kube-system", "cattle-fleet-*"}},
+			want:   []string{"cattle-system/broken", "default/broken"},
+		},
+		{
+			name:   "exclude wins",
+			filter: PodFilter{Namespaces: []string{"cattle-*", "default"}, ExcludeNamespaces: []string{"cattle-fleet-system"}},
+			want:   []string{"cattle-system/broken", "default/broken"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refs(diagnosePods(pods, nil, tt.filter, testNow)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func refs(pods []UnhealthyPod) []string {
+	var out []string
+	for _, p := range pods {
+		out = append(out, p.Ref())
+	}
+	return out
+}
+
+func equalUnhealthy(a, b UnhealthyPod) bool {
+	return slices.Equal(a.Containers, b.Containers) &&
+		a.Namespace == b.Namespace && a.Name == b.Name && a.Phase == b.Phase && a.Reason == b.Reason &&
+		a.Ready == b.Ready && a.Restarts == b.Restarts && a.Node == b.Node && a.OwnerKind == b.OwnerKind && a.Age == b.Age
+}
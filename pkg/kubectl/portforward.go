@@ -0,0 +1,83 @@
+package kubectl
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Forward is a running port-forward from 127.0.0.1:LocalPort to a pod.
+type Forward struct {
+	LocalPort int
+	// Pod is the pod traffic goes to, when known.
+	Pod string
+
+	once sync.Once
+	stop func()
+}
+
+// Close stops the port-forward.
+func (f *Forward) Close() {
+	if f.stop != nil {
+		f.once.Do(f.stop)
+	}
+}
+
+// parseTarget splits a port-forward target such as "service/nginx",
+// "svc/nginx", "pod/nginx-abc" or a bare pod name.
+func parseTarget(target string) (kind, name string, err error) {
+	kind, name, ok := strings.Cut(target, "/")
+	if !ok {
+		return "pod", target, nil
+	}
+	switch kind {
+	case "pod", "pods", "po":
+		return "pod", name, nil
+	case "service", "services", "svc":
+		return "service", name, nil
+	}
+	return "", "", fmt.Errorf("unsupported port-forward target %q (want pod/<name> or service/<name>)", target)
+}
+
+// servicePod picks a ready pod behind a service and the container port its
+// service port maps to, the way kubectl port-forward service/<name> does.
+func servicePod(svc *corev1.Service, pods []*corev1.Pod, port int) (pod string, podPort int, err error) {
+	var sp *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if int(svc.Spec.Ports[i].Port) == port {
+			sp = &svc.Spec.Ports[i]
+		}
+	}
+	if sp == nil {
+		return "", 0, fmt.Errorf("service %s/%s has no port %d", svc.Namespace, svc.Name, port)
+	}
+
+	pods = slices.Clone(pods)
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	for _, p := range pods {
+		if p.DeletionTimestamp != nil || !podReady(p) {
+			continue
+		}
+		switch {
+		case sp.TargetPort.Type == intstr.String:
+			for _, c := range p.Spec.Containers {
+				for _, cp := range c.Ports {
+					if cp.Name == sp.TargetPort.StrVal {
+						return p.Name, int(cp.ContainerPort), nil
+					}
+				}
+			}
+			return "", 0, fmt.Errorf("pod %s has no port named %s", p.Name, sp.TargetPort.StrVal)
+		case sp.TargetPort.IntVal != 0:
+			return p.Name, int(sp.TargetPort.IntVal), nil
+		default:
+			return p.Name, port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("service %s/%s has no ready pods", svc.Namespace, svc.Name)
+}
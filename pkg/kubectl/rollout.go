@@ -0,0 +1,231 @@
+package kubectl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+// Workload is a Deployment, StatefulSet or DaemonSet from a manifest.
+type Workload struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Selector is the workload's pod label selector, e.g. "app=nginx".
+	Selector string
+}
+
+func (w Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", strings.ToLower(w.Kind), w.Namespace, w.Name)
+}
+
+func (w Workload) gvk() schema.GroupVersionKind {
+	return appsv1.SchemeGroupVersion.WithKind(w.Kind)
+}
+
+// ManifestWorkloads returns the workloads defined in a manifest, in file
+// order, so rollouts can be awaited without knowing namespaces or labels.
+func ManifestWorkloads(manifestPath string) ([]Workload, error) {
+	objects, err := readManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var workloads []Workload
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		if gvk.Group != appsv1.GroupName {
+			continue
+		}
+		switch gvk.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+		default:
+			continue
+		}
+		w := Workload{Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		if w.Namespace == "" {
+			w.Namespace = metav1.NamespaceDefault
+		}
+		var spec struct {
+			Selector *metav1.LabelSelector `json:"selector"`
+		}
+		if raw, ok := obj.Object["spec"].(map[string]interface{}); ok {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+				return nil, fmt.Errorf("%s: %w", w, err)
+			}
+		}
+		if spec.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", w, err)
+			}
+			w.Selector = selector.String()
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
+
+// ManifestServices returns the namespace and name of every Service in a
+// manifest that gets a cluster IP, so DNS should resolve it.
+func ManifestServices(manifestPath string) ([]types.NamespacedName, error) {
+	objects, err := readManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var services []types.NamespacedName
+	for _, obj := range objects {
+		if obj.GroupVersionKind() != corev1.SchemeGroupVersion.WithKind("Service") {
+			continue
+		}
+		clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP")
+		serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+		if clusterIP == corev1.ClusterIPNone || serviceType == string(corev1.ServiceTypeExternalName) {
+			continue
+		}
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		services = append(services, types.NamespacedName{Namespace: namespace, Name: obj.GetName()})
+	}
+	return services, nil
+}
+
+// waitForRollouts polls the workloads with get until every rollout is
+// complete, like kubectl rollout status. A Deployment past its progress
+// deadline fails the wait right away.
+func waitForRollouts(ctx context.Context, workloads []Workload, interval time.Duration,
+	get func(context.Context, Workload) (*unstructured.Unstructured, error)) error {
+	pending := map[Workload]string{}
+	for _, w := range workloads {
+		pending[w] = "not checked yet"
+	}
+	for {
+		for _, w := range workloads {
+			if _, ok := pending[w]; !ok {
+				continue
+			}
+			obj, err := get(ctx, w)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				pending[w] = err.Error()
+				continue
+			}
+			done, msg, err := rolloutStatus(obj)
+			if err != nil {
+				return fmt.Errorf("%s: %w", w, err)
+			}
+			if done {
+				delete(pending, w)
+			} else {
+				pending[w] = msg
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			var waiting []string
+			for _, w := range workloads {
+				if msg, ok := pending[w]; ok {
+					waiting = append(waiting, fmt.Sprintf("%s: %s", w, msg))
+				}
+			}
+			return fmt.Errorf("timed out waiting for rollouts: %s", strings.Join(waiting, "; "))
+		case <-time.After(interval):
+		}
+	}
+}
+
+// rolloutStatus reports whether a workload's latest spec is fully rolled
+// out and, if not, what it is waiting for.
+func rolloutStatus(obj *unstructured.Unstructured) (done bool, msg string, err error) {
+	switch obj.GetKind() {
+	case "Deployment":
+		var d appsv1.Deployment
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &d); err != nil {
+			return false, "", err
+		}
+		if d.Generation > d.Status.ObservedGeneration {
+			return false, "waiting for the spec update to be observed", nil
+		}
+		for _, c := range d.Status.Conditions {
+			if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+				return false, "", fmt.Errorf("rollout exceeded its progress deadline: %s", c.Message)
+			}
+		}
+		want := ptr.Deref(d.Spec.Replicas, 1)
+		switch {
+		case d.Status.UpdatedReplicas < want:
+			return false, fmt.Sprintf("%d of %d new replicas updated", d.Status.UpdatedReplicas, want), nil
+		case d.Status.Replicas > d.Status.UpdatedReplicas:
+			return false, fmt.Sprintf("%d old replicas pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), nil
+		case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+			return false, fmt.Sprintf("%d of %d updated replicas available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), nil
+		}
+		return true, "", nil
+
+	case "StatefulSet":
+		var s appsv1.StatefulSet
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &s); err != nil {
+			return false, "", err
+		}
+		if s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			// Pods only change when deleted; there is no rollout to wait for.
+			return true, "", nil
+		}
+		if s.Generation > s.Status.ObservedGeneration {
+			return false, "waiting for the spec update to be observed", nil
+		}
+		want := ptr.Deref(s.Spec.Replicas, 1)
+		if s.Status.ReadyReplicas < want {
+			return false, fmt.Sprintf("%d of %d pods ready", s.Status.ReadyReplicas, want), nil
+		}
+		if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ptr.Deref(ru.Partition, 0) > 0 {
+			partition := *ru.Partition
+			if s.Status.UpdatedReplicas < want-partition {
+				return false, fmt.Sprintf("%d of %d pods updated (partition %d)", s.Status.UpdatedReplicas, want-partition, partition), nil
+			}
+			return true, "", nil
+		}
+		if s.Status.UpdateRevision != s.Status.CurrentRevision {
+			return false, fmt.Sprintf("%d of %d pods at revision %s", s.Status.UpdatedReplicas, want, s.Status.UpdateRevision), nil
+		}
+		return true, "", nil
+
+	case "DaemonSet":
+		var ds appsv1.DaemonSet
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &ds); err != nil {
+			return false, "", err
+		}
+		if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+			return true, "", nil
+		}
+		if ds.Generation > ds.Status.ObservedGeneration {
+			return false, "waiting for the spec update to be observed", nil
+		}
+		want := ds.Status.DesiredNumberScheduled
+		switch {
+		case ds.Status.UpdatedNumberScheduled < want:
+			return false, fmt.Sprintf("%d of %d updated pods scheduled", ds.Status.UpdatedNumberScheduled, want), nil
+		case ds.Status.NumberAvailable < want:
+			return false, fmt.Sprintf("%d of %d updated pods available", ds.Status.NumberAvailable, want), nil
+		}
+		return true, "", nil
+	}
+	return false, "", fmt.Errorf("no rollout status for kind %s", obj.GetKind())
+}
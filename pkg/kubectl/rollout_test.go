@@ -0,0 +1,66 @@
+package kubectl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRolloutStatus(t *testing.T) {
+	tests := map[string]struct {
+		done    bool
+		msg     string
+		wantErr string
+	}{
+		"deploy-complete":         {done: true},
+		"deploy-default-replicas": {done: true},
+		"deploy-stale-generation": {msg: "waiting for the spec update to be observed"},
+		"deploy-updating":         {msg: "1 of 3 new replicas updated"},
+		"deploy-old-replicas":     {msg: "1 old replicas pending termination"},
+		"deploy-unavailable":      {msg: "2 of 3 updated replicas available"},
+		"deploy-deadline":         {wantErr: `progress deadline: ReplicaSet "deploy-deadline-6b9f7" has timed out progressing.`},
+
+		"sts-complete":          {done: true},
+		"sts-stale-generation":  {msg: "waiting for the spec update to be observed"},
+		"sts-not-ready":         {msg: "1 of 3 pods ready"},
+		"sts-rolling":           {msg: "1 of 3 pods at revision sts-rolling-8d5f2"},
+		"sts-partition":         {done: true},
+		"sts-partition-pending": {msg: "0 of 1 pods updated (partition 2)"},
+		"sts-on-delete":         {done: true},
+
+		"ds-complete":         {done: true},
+		"ds-stale-generation": {msg: "waiting for the spec update to be observed"},
+		"ds-updating":         {msg: "1 of 3 updated pods scheduled"},
+		"ds-unavailable":      {msg: "2 of 3 updated pods available"},
+		"ds-on-delete":        {done: true},
+
+		"rs-unsupported": {wantErr: "no rollout status for kind ReplicaSet"},
+	}
+
+	objects, err := readManifest(filepath.Join("testdata", "rollouts.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != len(tests) {
+		t.Errorf("testdata has %d objects, want %d", len(objects), len(tests))
+	}
+	for _, obj := range objects {
+		t.Run(obj.GetName(), func(t *testing.T) {
+			tt, ok := tests[obj.GetName()]
+			if !ok {
+				t.Fatal("no expected result")
+			}
+			done, msg, err := rolloutStatus(obj)
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("err = %v", err)
+			case done != tt.done || msg != tt.msg:
+				t.Errorf("rolloutStatus = %v, %q; want %v, %q", done, msg, tt.done, tt.msg)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package rancher
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/rancher/norman/clientbase"
 	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
@@ -11,17 +10,12 @@ import (
 
 type Client struct {
 	URL    string
+	token  string
 	client *managementClient.Client
 }
 
 func NewClient(url, token string) (*Client, error) {
-	if !strings.HasPrefix(url, "http") {
-		url = fmt.Sprintf("https://%s", url)
-	}
-
-	if !strings.HasSuffix(url, "/v3") {
-		url = strings.TrimSuffix(url, "/") + "/v3"
-	}
+	url = normalizeURL(url)
 
 	opts := &clientbase.ClientOpts{
 		URL:      url,
@@ -36,10 +30,23 @@ func NewClient(url, token string) (*Client, error) {
 
 	return &Client{
 		URL:    url,
+		token:  token,
 		client: client,
 	}, nil
 }
 
+// normalizeURL adds a scheme if missing and points the URL at the /v3 API.
+func normalizeURL(url string) string {
+	if !strings.HasPrefix(url, "http") {
+		url = fmt.Sprintf("https://%s", url)
+	}
+
+	if !strings.HasSuffix(url, "/v3") {
+		url = strings.TrimSuffix(url, "/") + "/v3"
+	}
+	return url
+}
+
 func (c *Client) VerifyLogin() error {
 	_, err := c.client.Cluster.List(nil)
 	if err != nil {
@@ -71,26 +78,3 @@ func (c *Client) GetCluster(clusterID string) (*managementClient.Cluster, error)
 	fmt.Printf("  Cluster ID: %s\n", cluster.ID)
 	return cluster, nil
 }
-
-func (c *Client) WaitForClusterReady(clusterID string, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
-	pollInterval := 30 * time.Second
-
-	for time.Now().Before(deadline) {
-		cluster, err := c.client.Cluster.ByID(clusterID)
-		if err != nil {
-			fmt.Printf(" Warning: error polling cluster: %v (retrying...)\n", err)
-			time.Sleep(pollInterval)
-			continue
-		}
-
-		fmt.Printf(" Cluster state: %s | transitioning: %s\n", cluster.State, cluster.TransitioningMessage)
-
-		if cluster.State == "active" && cluster.Transitioning != "yes" {
-			return nil
-		}
-
-		time.Sleep(pollInterval)
-	}
-	return fmt.Errorf("cluster %s did not become active within %v", clusterID, timeout)
-}
@@ -0,0 +1,87 @@
+package rancher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+)
+
+// Login authenticates a user against Rancher's local auth provider and returns
+// the resulting session token in <name>:<secret> form.
+func Login(url, username, password string) (string, error) {
+	loginURL := strings.TrimSuffix(normalizeURL(url), "/v3") + "/v3-public/localProviders/local?action=login"
+
+	body, err := json.Marshal(map[string]string{
+		"username":     username,
+		"password":     password,
+		"description":  "hosted-rancher-testing login",
+		"responseType": "json",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	httpClient := &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			Proxy:           http.ProxyFromEnvironment,
+		},
+	}
+	resp, err := httpClient.Post(loginURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read login response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login as %s failed: %s: %s", username, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var token managementClient.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("parse login response: %w", err)
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("login response did not contain a token")
+	}
+	return token.Token, nil
+}
+
+// CreateToken mints a new API token for the client's user and returns it in
+// <name>:<secret> form. A zero ttl creates a token that does not expire.
+func (c *Client) CreateToken(description string, ttl time.Duration) (string, error) {
+	token, err := c.client.Token.Create(&managementClient.Token{
+		Description: description,
+		TTLMillis:   ttl.Milliseconds(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+	return token.Token, nil
+}
+
+// DeleteToken removes a token given either its name or its <name>:<secret> form.
+func (c *Client) DeleteToken(token string) error {
+	name, _, _ := strings.Cut(token, ":")
+
+	existing, err := c.client.Token.ByID(name)
+	if err != nil {
+		return fmt.Errorf("failed to get token %s: %w", name, err)
+	}
+	if err := c.client.Token.Delete(existing); err != nil {
+		return fmt.Errorf("failed to delete token %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package rancher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/norman/types"
+)
+
+const (
+	capiClusterLabel = "cluster.x-k8s.io/cluster-name"
+	machinePoolLabel = "rke.cattle.io/rke-machine-pool-name"
+)
+
+// Machine summarizes a CAPI Machine backing a node of a v2 cluster.
+type Machine struct {
+	Name       string
+	Pool       string
+	Phase      string
+	NodeName   string
+	IP         string
+	ProviderID string
+	// Failure is the machine's failure reason/message, or the message of the
+	// first unhealthy condition when no terminal failure is recorded.
+	Failure string
+}
+
+// MachinePool summarizes the MachineDeployment behind an rke machine pool.
+type MachinePool struct {
+	Name        string
+	Phase       string
+	Desired     int
+	Ready       int
+	Updated     int
+	Unavailable int
+}
+
+type steveList[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination pagination `json:"pagination"`
+	// Continue is steve's token for the next page.
+	Continue string `json:"continue"`
+}
+
+// pagination is the paging block of steve and norman list responses; Next
+// is the URL of the next page.
+type pagination struct {
+	Next string `json:"next"`
+}
+
+type capiMachine struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ProviderID string `json:"providerID"`
+	} `json:"spec"`
+	Status struct {
+		Phase   string `json:"phase"`
+		NodeRef *struct {
+			Name string `json:"name"`
+		} `json:"nodeRef"`
+		Addresses []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"addresses"`
+		FailureReason  string      `json:"failureReason"`
+		FailureMessage string      `json:"failureMessage"`
+		Conditions     []Condition `json:"conditions"`
+		// CAPI v1beta2 moved the failure fields under status.deprecated.
+		Deprecated struct {
+			V1Beta1 struct {
+				FailureReason  string `json:"failureReason"`
+				FailureMessage string `json:"failureMessage"`
+			} `json:"v1beta1"`
+		} `json:"deprecated"`
+	} `json:"status"`
+}
+
+type capiMachineDeployment struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		Phase               string `json:"phase"`
+		ReadyReplicas       int    `json:"readyReplicas"`
+		UpdatedReplicas     int    `json:"updatedReplicas"`
+		UnavailableReplicas int    `json:"unavailableReplicas"`
+	} `json:"status"`
+}
+
+func (m *capiMachine) toMachine() Machine {
+	machine := Machine{
+		Name:       m.Metadata.Name,
+		Pool:       m.Metadata.Labels[machinePoolLabel],
+		Phase:      m.Status.Phase,
+		ProviderID: m.Spec.ProviderID,
+	}
+	if m.Status.NodeRef != nil {
+		machine.NodeName = m.Status.NodeRef.Name
+	}
+	for _, addr := range m.Status.Addresses {
+		if addr.Type == "ExternalIP" || (machine.IP == "" && addr.Type == "InternalIP") {
+			machine.IP = addr.Address
+		}
+	}
+
+	reason, message := m.Status.FailureReason, m.Status.FailureMessage
+	if reason == "" && message == "" {
+		reason, message = m.Status.Deprecated.V1Beta1.FailureReason, m.Status.Deprecated.V1Beta1.FailureMessage
+	}
+	switch {
+	case reason != "" || message != "":
+		machine.Failure = strings.TrimPrefix(reason+": "+message, ": ")
+	default:
+		for _, cond := range m.Status.Conditions {
+			if cond.Status == "False" && cond.Message != "" {
+				machine.Failure = cond.Type + ": " + cond.Message
+				break
+			}
+		}
+	}
+	return machine
+}
+
+// ListMachines returns the CAPI machines of a v2 cluster, sorted by name.
+func (c *Client) ListMachines(clusterName string) ([]Machine, error) {
+	list, err := listSteve[capiMachine](c, "cluster.x-k8s.io.machines", capiClusterLabel+"="+clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines for %s: %w", clusterName, err)
+	}
+
+	machines := make([]Machine, 0, len(list))
+	for i := range list {
+		machines = append(machines, list[i].toMachine())
+	}
+	sort.Slice(machines, func(i, j int) bool { return machines[i].Name < machines[j].Name })
+	return machines, nil
+}
+
+// ListMachinePools returns the machine deployments of a v2 cluster.
+func (c *Client) ListMachinePools(clusterName string) ([]MachinePool, error) {
+	list, err := listSteve[capiMachineDeployment](c, "cluster.x-k8s.io.machinedeployments", capiClusterLabel+"="+clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machine pools for %s: %w", clusterName, err)
+	}
+
+	pools := make([]MachinePool, 0, len(list))
+	for _, md := range list {
+		pool := MachinePool{
+			Name:        md.Metadata.Name,
+			Phase:       md.Status.Phase,
+			Ready:       md.Status.ReadyReplicas,
+			Updated:     md.Status.UpdatedReplicas,
+			Unavailable: md.Status.UnavailableReplicas,
+		}
+		if md.Spec.Replicas != nil {
+			pool.Desired = *md.Spec.Replicas
+		}
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools, nil
+}
+
+// WriteMachineTable renders machine pools and machines as aligned tables.
+func WriteMachineTable(w io.Writer, pools []MachinePool, machines []Machine) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  POOL\tPHASE\tDESIRED\tREADY\tUPDATED\tUNAVAILABLE")
+	for _, p := range pools {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\t%d\t%d\n", p.Name, p.Phase, p.Desired, p.Ready, p.Updated, p.Unavailable)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "  MACHINE\tPHASE\tNODE\tIP\tPROVIDER ID\tFAILURE")
+	for _, m := range machines {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", m.Name, m.Phase, dash(m.NodeName), dash(m.IP), dash(m.ProviderID), dash(m.Failure))
+	}
+	tw.Flush()
+}
+
+// WatchMachines polls the cluster's machines every interval and writes a
+// fresh table to w whenever anything changes, until ctx is done. It is meant
+// to run in the background while terraform apply or an upgrade wait blocks.
+func (c *Client) WatchMachines(ctx context.Context, clusterName string, interval time.Duration, w io.Writer) {
+	var last string
+	for {
+		pools, perr := c.ListMachinePools(clusterName)
+		machines, merr := c.ListMachines(clusterName)
+		if perr == nil && merr == nil && (len(pools) > 0 || len(machines) > 0) {
+			var buf bytes.Buffer
+			WriteMachineTable(&buf, pools, machines)
+			if table := buf.String(); table != last {
+				fmt.Fprintf(w, "\n--- machines for %s (%s) ---\n%s\n", clusterName, time.Now().Format("15:04:05"), table)
+				last = table
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// listSteve reads every page of a steve resource in the provisioning
+// namespace, optionally filtered by a label selector.
+func listSteve[T any](c *Client, resource, labelSelector string) ([]T, error) {
+	filters := map[string]interface{}{}
+	if labelSelector != "" {
+		filters["labelSelector"] = labelSelector
+	}
+	return listAll[T](c, c.steveURL(resource+"/"+ProvisioningNamespace), filters)
+}
+
+// listAll reads every page of a steve or norman list at url, following
+// pagination.next or steve's continue token.
+func listAll[T any](c *Client, url string, filters map[string]interface{}) ([]T, error) {
+	var items []T
+	opts := &types.ListOpts{Filters: filters}
+	for {
+		var page steveList[T]
+		if err := c.client.Ops.DoGet(url, opts, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Data...)
+		switch {
+		case page.Pagination.Next != "":
+			// The next URL already carries the filters.
+			url, opts = page.Pagination.Next, nil
+		case page.Continue != "":
+			next := map[string]interface{}{"continue": page.Continue}
+			for k, v := range filters {
+				next[k] = v
+			}
+			opts = &types.ListOpts{Filters: next}
+		default:
+			return items, nil
+		}
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
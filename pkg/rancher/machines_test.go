@@ -0,0 +1,98 @@
+package rancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// newPagedServer serves the cluster's machines and machine deployments two
+// at a time with steve's continue token, and checks every page request
+// keeps the label selector.
+func newPagedServer(t *testing.T, cluster string, machines, pools int) *Client {
+	t.Helper()
+	items := map[string][]map[string]interface{}{}
+	for i := 0; i < machines; i++ {
+		items["cluster.x-k8s.io.machines"] = append(items["cluster.x-k8s.io.machines"], map[string]interface{}{
+			"metadata": map[string]interface{}{"name": fmt.Sprintf("%s-pool1-%d", cluster, i)},
+			"status":   map[string]interface{}{"phase": "Running"},
+		})
+	}
+	for i := 0; i < pools; i++ {
+		items["cluster.x-k8s.io.machinedeployments"] = append(items["cluster.x-k8s.io.machinedeployments"], map[string]interface{}{
+			"metadata": map[string]interface{}{"name": fmt.Sprintf("%s-pool%d", cluster, i)},
+			"spec":     map[string]interface{}{"replicas": 3},
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v3" {
+			w.Header().Set("X-API-Schemas", "http://"+r.Host+"/v3")
+			json.NewEncoder(w).Encode(map[string]interface{}{"type": "collection", "data": []interface{}{}})
+			return
+		}
+		for resource, list := range items {
+			if r.URL.Path != "/v1/"+resource+"/"+ProvisioningNamespace {
+				continue
+			}
+			if got, want := r.URL.Query().Get("labelSelector"), capiClusterLabel+"="+cluster; got != want {
+				t.Errorf("%s: labelSelector = %q, want %q", r.URL, got, want)
+			}
+			offset, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+			end := min(offset+2, len(list))
+			page := map[string]interface{}{"type": "collection", "data": list[offset:end]}
+			if end < len(list) {
+				page["continue"] = strconv.Itoa(end)
+			}
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(srv.URL, "token-fake:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestListMachinesPaginated(t *testing.T) {
+	client := newPagedServer(t, "nightly", 5, 3)
+
+	machines, err := client.ListMachines("nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range machines {
+		names = append(names, m.Name)
+	}
+	want := []string{"nightly-pool1-0", "nightly-pool1-1", "nightly-pool1-2", "nightly-pool1-3", "nightly-pool1-4"}
+	if !slices.Equal(names, want) {
+		t.Errorf("machines = %q, want %q", names, want)
+	}
+
+	pools, err := client.ListMachinePools("nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 3 || pools[2].Name != "nightly-pool2" || pools[2].Desired != 3 {
+		t.Errorf("pools = %+v, want nightly-pool0..2 with 3 desired", pools)
+	}
+
+	raw, err := client.RawMachines("nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rawList []json.RawMessage
+	if err := json.Unmarshal(raw, &rawList); err != nil || len(rawList) != 5 {
+		t.Errorf("RawMachines = %d machines, %v; want 5", len(rawList), err)
+	}
+}
@@ -0,0 +1,215 @@
+package rancher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Ownership labels and annotations stamped on everything this tool creates
+// in Rancher, so leftovers can be audited and reaped.
+const (
+	ToolName = "hosted-rancher-testing"
+
+	LabelTool    = "hosted-rancher-testing.io/tool"
+	LabelCluster = "hosted-rancher-testing.io/cluster"
+	LabelRunID   = "hosted-rancher-testing.io/run-id"
+	LabelOwner   = "hosted-rancher-testing.io/owner"
+
+	AnnotationRunID     = "hosted-rancher-testing.io/run-id"
+	AnnotationOwner     = "hosted-rancher-testing.io/owner"
+	AnnotationCreatedAt = "hosted-rancher-testing.io/created-at"
+	AnnotationExpiresAt = "hosted-rancher-testing.io/expires-at"
+	AnnotationGitCommit = "hosted-rancher-testing.io/git-commit"
+
+	// DropletTagPrefix starts the cloud tags naming a droplet's cluster
+	// and run, e.g. hrt-cluster:my-test.
+	DropletTagPrefix = "hrt-"
+)
+
+const machineConfigResource = "rke-machine-config.cattle.io.digitaloceanconfigs"
+
+var (
+	invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+	invalidTagChars   = regexp.MustCompile(`[^A-Za-z0-9:_-]`)
+)
+
+// labelValue makes s a valid Kubernetes label value.
+func labelValue(s string) string {
+	s = invalidLabelChars.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
+
+// Ownership describes who created a run's resources, and until when they
+// are needed.
+type Ownership struct {
+	Cluster   string
+	RunID     string
+	Owner     string
+	GitCommit string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Labels are stamped on the run's Rancher objects for selection.
+func (o Ownership) Labels() map[string]string {
+	labels := map[string]string{
+		LabelTool:    ToolName,
+		LabelCluster: labelValue(o.Cluster),
+		LabelRunID:   labelValue(o.RunID),
+	}
+	if owner := labelValue(o.Owner); owner != "" {
+		labels[LabelOwner] = owner
+	}
+	return labels
+}
+
+// Annotations are stamped on the run's Rancher objects for auditing.
+// Unlike labels they keep values unmodified.
+func (o Ownership) Annotations() map[string]string {
+	annotations := map[string]string{
+		AnnotationRunID:     o.RunID,
+		AnnotationCreatedAt: o.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if o.Owner != "" {
+		annotations[AnnotationOwner] = o.Owner
+	}
+	if !o.ExpiresAt.IsZero() {
+		annotations[AnnotationExpiresAt] = o.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if o.GitCommit != "" {
+		annotations[AnnotationGitCommit] = o.GitCommit
+	}
+	return annotations
+}
+
+// DropletTags are the cloud provider tags for the run's droplets.
+func (o Ownership) DropletTags() []string {
+	tag := func(key, value string) string {
+		t := DropletTagPrefix + key + ":" + invalidTagChars.ReplaceAllString(value, "-")
+		if len(t) > 255 {
+			t = t[:255]
+		}
+		return t
+	}
+	tags := []string{ToolName, ClusterTag(o.Cluster), tag("run", o.RunID)}
+	if o.Owner != "" {
+		tags = append(tags, tag("owner", o.Owner))
+	}
+	return tags
+}
+
+// ClusterTag is the droplet tag naming the cluster a droplet belongs to.
+func ClusterTag(clusterName string) string {
+	return DropletTagPrefix + "cluster:" + invalidTagChars.ReplaceAllString(clusterName, "-")
+}
+
+// OwnedObject is a Rancher object created by this tool.
+type OwnedObject struct {
+	// Kind is "cluster", "cloud-credential" or "machine-config".
+	Kind      string
+	Name      string
+	Cluster   string
+	RunID     string
+	Owner     string
+	CreatedAt time.Time
+	// ExpiresAt is when the creating run said the object may be deleted;
+	// zero if it didn't say.
+	ExpiresAt time.Time
+	// deletePath is the object's API URL.
+	deletePath string
+}
+
+func (o *OwnedObject) String() string {
+	return fmt.Sprintf("%s %s", o.Kind, o.Name)
+}
+
+func newOwnedObject(kind, name, created string, labels, annotations map[string]string, deletePath string) *OwnedObject {
+	if labels[LabelTool] != ToolName {
+		return nil
+	}
+	obj := &OwnedObject{
+		Kind:       kind,
+		Name:       name,
+		Cluster:    labels[LabelCluster],
+		RunID:      annotations[AnnotationRunID],
+		deletePath: deletePath,
+	}
+	if obj.RunID == "" {
+		obj.RunID = labels[LabelRunID]
+	}
+	obj.Owner = annotations[AnnotationOwner]
+	if obj.Owner == "" {
+		obj.Owner = labels[LabelOwner]
+	}
+	obj.ExpiresAt, _ = time.Parse(time.RFC3339, annotations[AnnotationExpiresAt])
+	if stamped := annotations[AnnotationCreatedAt]; stamped != "" {
+		created = stamped
+	}
+	obj.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	return obj
+}
+
+// ListOwned returns the provisioning clusters, cloud credentials and machine
+// configs carrying this tool's ownership label, reading every page.
+func (c *Client) ListOwned() ([]*OwnedObject, error) {
+	selector := map[string]interface{}{"labelSelector": LabelTool + "=" + ToolName}
+	var owned []*OwnedObject
+
+	clusters, err := listAll[ProvisioningCluster](c, c.steveURL("provisioning.cattle.io.clusters/"+ProvisioningNamespace), selector)
+	if err != nil {
+		return nil, fmt.Errorf("list provisioning clusters: %w", err)
+	}
+	for _, cl := range clusters {
+		m := cl.Metadata
+		path := c.steveURL("provisioning.cattle.io.clusters/" + ProvisioningNamespace + "/" + m.Name)
+		if obj := newOwnedObject("cluster", m.Name, m.CreationTimestamp, m.Labels, m.Annotations, path); obj != nil {
+			obj.Cluster = m.Name
+			owned = append(owned, obj)
+		}
+	}
+
+	configs, err := listAll[struct {
+		Metadata ObjectMeta `json:"metadata"`
+	}](c, c.steveURL(machineConfigResource+"/"+ProvisioningNamespace), selector)
+	if err != nil {
+		return nil, fmt.Errorf("list machine configs: %w", err)
+	}
+	for _, mc := range configs {
+		m := mc.Metadata
+		path := c.steveURL(machineConfigResource + "/" + ProvisioningNamespace + "/" + m.Name)
+		if obj := newOwnedObject("machine-config", m.Name, m.CreationTimestamp, m.Labels, m.Annotations, path); obj != nil {
+			owned = append(owned, obj)
+		}
+	}
+
+	creds, err := listAll[struct {
+		ID          string            `json:"id"`
+		Name        string            `json:"name"`
+		Created     string            `json:"created"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	}](c, c.URL+"/cloudcredentials", nil)
+	if err != nil {
+		return nil, fmt.Errorf("list cloud credentials: %w", err)
+	}
+	for _, cc := range creds {
+		if obj := newOwnedObject("cloud-credential", cc.Name, cc.Created, cc.Labels, cc.Annotations, c.URL+"/cloudcredentials/"+cc.ID); obj != nil {
+			owned = append(owned, obj)
+		}
+	}
+	return owned, nil
+}
+
+// DeleteOwned deletes an object returned by ListOwned. Rancher removes a
+// cluster's machines and cloud instances asynchronously.
+func (c *Client) DeleteOwned(obj *OwnedObject) error {
+	if err := c.client.Ops.DoDelete(obj.deletePath); err != nil {
+		return fmt.Errorf("delete %s: %w", obj, err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package rancher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/norman/clientbase"
+)
+
+// ProvisioningNamespace is where Rancher keeps v2-provisioned clusters and
+// their machines.
+const ProvisioningNamespace = "fleet-default"
+
+// Condition is a Kubernetes-style status condition.
+type Condition struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason,omitempty"`
+	Message        string `json:"message,omitempty"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
+
+// ObjectMeta holds the metadata fields we read from steve objects, including
+// the summarized state steve adds.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	Generation        int64             `json:"generation"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	State             struct {
+		Name          string `json:"name"`
+		Transitioning bool   `json:"transitioning"`
+		Error         bool   `json:"error"`
+		Message       string `json:"message"`
+	} `json:"state"`
+}
+
+// ProvisioningCluster is a provisioning.cattle.io/v1 Cluster.
+type ProvisioningCluster struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		KubernetesVersion string `json:"kubernetesVersion"`
+	} `json:"spec"`
+	Status struct {
+		ClusterName        string      `json:"clusterName"`
+		Ready              bool        `json:"ready"`
+		ObservedGeneration int64       `json:"observedGeneration"`
+		Conditions         []Condition `json:"conditions"`
+	} `json:"status"`
+}
+
+// ControlPlane is an rke.cattle.io/v1 RKEControlPlane.
+type ControlPlane struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		KubernetesVersion string `json:"kubernetesVersion"`
+	} `json:"spec"`
+	Status struct {
+		Ready              bool        `json:"ready"`
+		AgentConnected     bool        `json:"agentConnected"`
+		ObservedGeneration int64       `json:"observedGeneration"`
+		Conditions         []Condition `json:"conditions"`
+	} `json:"status"`
+}
+
+// Condition returns the named condition, or nil if it is not set.
+func (p *ProvisioningCluster) Condition(conditionType string) *Condition {
+	return findCondition(p.Status.Conditions, conditionType)
+}
+
+// Pending explains why the cluster has not settled, or returns "" once it
+// is ready, provisioned, updated and has observed its latest spec.
+func (p *ProvisioningCluster) Pending() string {
+	if p.Status.ObservedGeneration < p.Metadata.Generation {
+		return fmt.Sprintf("generation %d not yet observed (at %d)", p.Metadata.Generation, p.Status.ObservedGeneration)
+	}
+	if reason := pendingConditions(p.Status.Conditions, "Provisioned", "Updated", "Ready"); reason != "" {
+		return reason
+	}
+	if !p.Status.Ready {
+		return "status.ready is false"
+	}
+	return ""
+}
+
+// Pending explains why the control plane has not settled, or returns "".
+func (cp *ControlPlane) Pending() string {
+	if cp.Status.ObservedGeneration < cp.Metadata.Generation {
+		return fmt.Sprintf("control plane generation %d not yet observed (at %d)", cp.Metadata.Generation, cp.Status.ObservedGeneration)
+	}
+	if !cp.Status.Ready {
+		if reason := pendingConditions(cp.Status.Conditions, "Ready"); reason != "" {
+			return "control plane " + reason
+		}
+		return "control plane not ready"
+	}
+	return ""
+}
+
+func findCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+func pendingConditions(conditions []Condition, required ...string) string {
+	var pending []string
+	for _, t := range required {
+		cond := findCondition(conditions, t)
+		switch {
+		case cond == nil:
+			pending = append(pending, t+"=Unknown")
+		case cond.Status != "True":
+			msg := t + "=" + cond.Status
+			if cond.Message != "" {
+				msg += " (" + cond.Message + ")"
+			}
+			pending = append(pending, msg)
+		}
+	}
+	return strings.Join(pending, ", ")
+}
+
+// GetProvisioningCluster fetches the v2 provisioning cluster by name. It
+// returns nil without error when the cluster is not v2-provisioned.
+func (c *Client) GetProvisioningCluster(name string) (*ProvisioningCluster, error) {
+	var cluster ProvisioningCluster
+	err := c.steveGet("provisioning.cattle.io.clusters/"+ProvisioningNamespace+"/"+name, &cluster)
+	if clientbase.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provisioning cluster %s: %w", name, err)
+	}
+	return &cluster, nil
+}
+
+// GetControlPlane fetches the RKEControlPlane backing a v2 cluster.
+func (c *Client) GetControlPlane(name string) (*ControlPlane, error) {
+	var cp ControlPlane
+	if err := c.steveGet("rke.cattle.io.rkecontrolplanes/"+ProvisioningNamespace+"/"+name, &cp); err != nil {
+		return nil, fmt.Errorf("failed to get control plane %s: %w", name, err)
+	}
+	return &cp, nil
+}
+
+// VerifyUpgrade checks that the v2 cluster and its control plane have both
+// picked up the target Kubernetes version and settled. It catches clusters
+// that report active in v3 while still rolling out the change.
+func (c *Client) VerifyUpgrade(name, version string) error {
+	cluster, err := c.GetProvisioningCluster(name)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		return fmt.Errorf("provisioning cluster %s not found", name)
+	}
+	if cluster.Spec.KubernetesVersion != version {
+		return fmt.Errorf("cluster %s spec has kubernetesVersion %s, expected %s", name, cluster.Spec.KubernetesVersion, version)
+	}
+	if pending := cluster.Pending(); pending != "" {
+		return fmt.Errorf("cluster %s has not settled: %s", name, pending)
+	}
+
+	cp, err := c.GetControlPlane(name)
+	if err != nil {
+		return err
+	}
+	if cp.Spec.KubernetesVersion != version {
+		return fmt.Errorf("control plane %s has kubernetesVersion %s, expected %s", name, cp.Spec.KubernetesVersion, version)
+	}
+	if pending := cp.Pending(); pending != "" {
+		return fmt.Errorf("cluster %s: %s", name, pending)
+	}
+	return nil
+}
+
+// steveGet reads an object from Rancher's steve API (/v1).
+func (c *Client) steveGet(path string, out interface{}) error {
+	return c.client.Ops.DoGet(c.steveURL(path), nil, out)
+}
+
+func (c *Client) steveURL(path string) string {
+	return strings.TrimSuffix(c.URL, "/v3") + "/v1/" + path
+}
+
+// RawCluster returns the management v3 cluster object as indented JSON.
+func (c *Client) RawCluster(clusterID string) ([]byte, error) {
+	return c.rawGet(c.URL + "/clusters/" + clusterID)
+}
+
+// RawProvisioningCluster returns the v2 provisioning cluster as indented JSON.
+func (c *Client) RawProvisioningCluster(name string) ([]byte, error) {
+	return c.rawGet(c.steveURL("provisioning.cattle.io.clusters/" + ProvisioningNamespace + "/" + name))
+}
+
+// RawMachines returns the cluster's CAPI machines as an indented JSON array.
+func (c *Client) RawMachines(clusterName string) ([]byte, error) {
+	list, err := listSteve[json.RawMessage](c, "cluster.x-k8s.io.machines", capiClusterLabel+"="+clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+func (c *Client) rawGet(url string) ([]byte, error) {
+	var raw json.RawMessage
+	if err := c.client.Ops.DoGet(url, nil, &raw); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(raw, "", "  ")
+}
@@ -0,0 +1,50 @@
+package rancher
+
+import (
+	"fmt"
+
+	"github.com/rancher/norman/types"
+)
+
+// Leftovers lists the Rancher objects of a v2 cluster that still exist:
+// the management and provisioning clusters, its machines, and the cloud
+// credential and machine configs labelled with the cluster's name. It is
+// empty once the cluster has been fully torn down.
+func (c *Client) Leftovers(clusterName string) ([]string, error) {
+	var leftovers []string
+
+	clusters, err := c.client.Cluster.List(&types.ListOpts{Filters: map[string]interface{}{"name": clusterName}})
+	if err != nil {
+		return nil, fmt.Errorf("list management clusters: %w", err)
+	}
+	for _, cl := range clusters.Data {
+		leftovers = append(leftovers, fmt.Sprintf("management cluster %s (%s, %s)", cl.Name, cl.ID, cl.State))
+	}
+
+	provisioning, err := c.GetProvisioningCluster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if provisioning != nil {
+		leftovers = append(leftovers, "provisioning cluster "+clusterName)
+	}
+
+	machines, err := c.ListMachines(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		leftovers = append(leftovers, fmt.Sprintf("machine %s (%s)", m.Name, dash(m.Phase)))
+	}
+
+	owned, err := c.ListOwned()
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range owned {
+		if obj.Kind != "cluster" && obj.Cluster == labelValue(clusterName) {
+			leftovers = append(leftovers, obj.String())
+		}
+	}
+	return leftovers, nil
+}
@@ -0,0 +1,119 @@
+package rancher
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rancher/norman/types"
+)
+
+// TokenInfo describes the API token the client authenticates with.
+type TokenInfo struct {
+	Name        string
+	Description string
+	UserID      string
+	ClusterID   string
+	TTL         time.Duration
+	ExpiresAt   time.Time
+	Expired     bool
+	Enabled     bool
+	GlobalRoles []string
+}
+
+// Expires reports whether the token has an expiry at all (TTL 0 never expires).
+func (t *TokenInfo) Expires() bool {
+	return !t.ExpiresAt.IsZero()
+}
+
+// CurrentToken looks up the token used by this client via /v3/tokens,
+// along with the global roles bound to its owning user.
+func (c *Client) CurrentToken() (*TokenInfo, error) {
+	name, _, ok := strings.Cut(c.token, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("token is not in <name>:<secret> form")
+	}
+
+	token, err := c.client.Token.ByID(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token %s: %w", name, err)
+	}
+
+	info := &TokenInfo{
+		Name:        token.Name,
+		Description: token.Description,
+		UserID:      token.UserID,
+		ClusterID:   token.ClusterID,
+		TTL:         time.Duration(token.TTLMillis) * time.Millisecond,
+		Expired:     token.Expired,
+		Enabled:     token.Enabled == nil || *token.Enabled,
+	}
+	if token.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("parse token expiry %q: %w", token.ExpiresAt, err)
+		}
+		info.ExpiresAt = expiresAt
+	}
+
+	bindings, err := c.client.GlobalRoleBinding.ListAll(&types.ListOpts{
+		Filters: map[string]interface{}{"userId": token.UserID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list global roles for %s: %w", token.UserID, err)
+	}
+	for _, binding := range bindings.Data {
+		info.GlobalRoles = append(info.GlobalRoles, binding.GlobalRoleID)
+	}
+
+	return info, nil
+}
+
+// CheckToken refuses tokens that are disabled, expired or will expire within
+// runDuration, and returns warnings for tokens that are likely to fail later
+// in the run (cluster-scoped, or missing create permissions).
+func (c *Client) CheckToken(runDuration time.Duration) (*TokenInfo, []string, error) {
+	info, err := c.CurrentToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !info.Enabled {
+		return info, nil, fmt.Errorf("token %s is disabled", info.Name)
+	}
+	if info.Expired {
+		return info, nil, fmt.Errorf("token %s has expired", info.Name)
+	}
+	if info.Expires() {
+		remaining := time.Until(info.ExpiresAt)
+		if remaining < runDuration {
+			return info, nil, fmt.Errorf("token %s expires in %s, but the run is estimated to take %s",
+				info.Name, remaining.Round(time.Minute), runDuration)
+		}
+	}
+
+	var warnings []string
+	if info.ClusterID != "" {
+		warnings = append(warnings, fmt.Sprintf("token is scoped to cluster %s and cannot manage other clusters", info.ClusterID))
+	}
+	// Rancher filters schema collection methods by the caller's permissions,
+	// so a missing POST means the user cannot create that resource.
+	for _, schemaType := range []string{"cluster", "cloudCredential"} {
+		if !c.canCreate(schemaType) {
+			warnings = append(warnings, fmt.Sprintf("user %s does not appear to have permission to create %s resources (global roles: %s)",
+				info.UserID, schemaType, strings.Join(info.GlobalRoles, ", ")))
+		}
+	}
+
+	return info, warnings, nil
+}
+
+func (c *Client) canCreate(schemaType string) bool {
+	schema, ok := c.client.Types[schemaType]
+	if !ok {
+		return false
+	}
+	return slices.Contains(schema.CollectionMethods, http.MethodPost)
+}
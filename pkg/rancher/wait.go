@@ -0,0 +1,236 @@
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	managementClient "github.com/rancher/rancher/pkg/client/generated/management/v3"
+)
+
+const (
+	pollInterval    = 30 * time.Second
+	maxWatchBackoff = 30 * time.Second
+)
+
+// ConditionStatus is a single cluster condition as reported by Rancher.
+type ConditionStatus struct {
+	Type    string
+	Status  string
+	Reason  string
+	Message string
+}
+
+// ClusterProgress is a snapshot of a cluster's state passed to progress callbacks.
+type ClusterProgress struct {
+	State                string
+	Transitioning        string
+	TransitioningMessage string
+	Conditions           []ConditionStatus
+
+	// Provisioning holds the provisioning.cattle.io cluster conditions and
+	// Pending why it has not settled; both are empty for non-v2 clusters.
+	Provisioning []ConditionStatus
+	Pending      string
+}
+
+// Ready reports whether the cluster is active, no longer transitioning and,
+// for v2 clusters, fully provisioned and updated.
+func (p ClusterProgress) Ready() bool {
+	return p.State == "active" && p.Transitioning != "yes" && p.Pending == ""
+}
+
+func (p ClusterProgress) equal(o ClusterProgress) bool {
+	if p.State != o.State || p.Transitioning != o.Transitioning || p.TransitioningMessage != o.TransitioningMessage || p.Pending != o.Pending {
+		return false
+	}
+	return slices.Equal(p.Conditions, o.Conditions) && slices.Equal(p.Provisioning, o.Provisioning)
+}
+
+// ProgressFunc is called whenever the observed cluster state changes.
+type ProgressFunc func(ClusterProgress)
+
+func progressFromCluster(cluster *managementClient.Cluster) ClusterProgress {
+	p := ClusterProgress{
+		State:                cluster.State,
+		Transitioning:        cluster.Transitioning,
+		TransitioningMessage: cluster.TransitioningMessage,
+	}
+	for _, cond := range cluster.Conditions {
+		p.Conditions = append(p.Conditions, ConditionStatus{
+			Type:    cond.Type,
+			Status:  cond.Status,
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+	return p
+}
+
+func (p *ClusterProgress) addProvisioning(cluster *ProvisioningCluster) {
+	for _, cond := range cluster.Status.Conditions {
+		p.Provisioning = append(p.Provisioning, ConditionStatus{
+			Type:    cond.Type,
+			Status:  cond.Status,
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+	p.Pending = cluster.Pending()
+}
+
+// WaitForClusterReady blocks until the cluster is active and settled, or ctx
+// is done. It subscribes to Rancher's websocket to react to changes as they
+// happen and polls with jitter as a fallback in case the watch drops events
+// or cannot be established.
+func (c *Client) WaitForClusterReady(ctx context.Context, clusterID string, onProgress ProgressFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go c.watchCluster(ctx, clusterID, changed)
+
+	var last ClusterProgress
+	seen := false
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cluster %s did not become ready (last state: %s %s %s): %w",
+				clusterID, last.State, last.TransitioningMessage, last.Pending, ctx.Err())
+		case <-changed:
+		case <-timer.C:
+			timer.Reset(jitter(pollInterval))
+		}
+
+		cluster, err := c.client.Cluster.ByID(clusterID)
+		if err != nil {
+			fmt.Printf(" Warning: error polling cluster: %v (retrying...)\n", err)
+			continue
+		}
+
+		progress := progressFromCluster(cluster)
+		v2, err := c.GetProvisioningCluster(cluster.Name)
+		if err != nil {
+			fmt.Printf(" Warning: error polling provisioning cluster: %v (retrying...)\n", err)
+			continue
+		}
+		if v2 != nil {
+			progress.addProvisioning(v2)
+		}
+		if !seen || !progress.equal(last) {
+			if onProgress != nil {
+				onProgress(progress)
+			}
+			last, seen = progress, true
+		}
+
+		if progress.Ready() {
+			return nil
+		}
+	}
+}
+
+// watchCluster signals changed whenever Rancher reports a change to the
+// cluster, reconnecting with backoff until ctx is done.
+func (c *Client) watchCluster(ctx context.Context, clusterID string, changed chan<- struct{}) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		connectedAt := time.Now()
+		_ = c.subscribe(ctx, "cluster", func(id string) {
+			if id != clusterID {
+				return
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		// Only back off when connections keep failing quickly.
+		if time.Since(connectedAt) > time.Minute {
+			backoff = time.Second
+		} else {
+			backoff = min(backoff*2, maxWatchBackoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jitter(backoff)):
+		}
+	}
+}
+
+type subscribeEvent struct {
+	Name         string `json:"name"`
+	ResourceType string `json:"resourceType"`
+	Data         struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// subscribe streams resource.change events for resourceType from the v3
+// subscribe websocket until the connection fails or ctx is done.
+func (c *Client) subscribe(ctx context.Context, resourceType string, onChange func(id string)) error {
+	u, err := url.Parse(c.URL + "/subscribe")
+	if err != nil {
+		return err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.RawQuery = url.Values{
+		"eventNames":   {"resource.change"},
+		"resourceType": {resourceType},
+	}.Encode()
+
+	conn, _, err := c.client.Websocket(u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("subscribe to %s changes: %w", resourceType, err)
+	}
+
+	// The goroutine closes the connection on ctx, unblocking ReadMessage.
+	// Returning stops it and waits, so a redial never leaves it behind.
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var event subscribeEvent
+		if err := json.Unmarshal(msg, &event); err != nil {
+			continue
+		}
+		if event.Name == "resource.change" && event.ResourceType == resourceType {
+			onChange(event.Data.ID)
+		}
+	}
+}
+
+// jitter spreads d by +/-20% so concurrent runs don't poll in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*0.4-0.2)*float64(d))
+}
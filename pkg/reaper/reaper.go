@@ -0,0 +1,233 @@
+// Package reaper deletes test clusters and their Rancher objects left
+// behind by interrupted or abandoned runs.
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/rancher"
+)
+
+// API is the part of the Rancher client the reaper uses.
+type API interface {
+	ListOwned() ([]*rancher.OwnedObject, error)
+	DeleteOwned(obj *rancher.OwnedObject) error
+}
+
+// Options control what is reaped.
+type Options struct {
+	// TTL is the age after which an object is reaped, even if its
+	// expires-at annotation says it is still needed.
+	TTL time.Duration
+	// Finished, if set, reports whether the run that created a cluster has
+	// ended; its objects are then reaped regardless of age.
+	Finished func(cluster, runID string) bool
+	// DryRun only prints what would be deleted.
+	DryRun bool
+	// Wait bounds how long to wait for reaped clusters to disappear before
+	// deleting their cloud credentials and machine configs, which Rancher
+	// still needs to remove the cluster's machines.
+	Wait time.Duration
+	// PollInterval is how often to check for deleted clusters.
+	PollInterval time.Duration
+}
+
+// Decision is what the reaper does with one object and why.
+type Decision struct {
+	Object *rancher.OwnedObject
+	Reap   bool
+	Reason string
+}
+
+// Decide picks the owned objects to reap. Cloud credentials and machine
+// configs follow their cluster; without one they are judged on their own.
+func Decide(objects []*rancher.OwnedObject, opts Options, now time.Time) []Decision {
+	clusters := map[string]Decision{}
+	for _, obj := range objects {
+		if obj.Kind == "cluster" {
+			clusters[obj.Cluster] = judge(obj, opts, now)
+		}
+	}
+
+	decisions := make([]Decision, 0, len(objects))
+	for _, obj := range objects {
+		d, ok := clusters[obj.Cluster]
+		switch {
+		case obj.Kind == "cluster":
+		case ok:
+			d = Decision{Reap: d.Reap, Reason: "belongs to cluster " + obj.Cluster}
+		default:
+			d = judge(obj, opts, now)
+			d.Reason = "orphaned, " + d.Reason
+		}
+		d.Object = obj
+		decisions = append(decisions, d)
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		a, b := decisions[i].Object, decisions[j].Object
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return kindOrder(a.Kind) < kindOrder(b.Kind)
+	})
+	return decisions
+}
+
+// kindOrder lists a cluster before the objects it depends on.
+func kindOrder(kind string) string {
+	if kind == "cluster" {
+		return ""
+	}
+	return kind
+}
+
+func judge(obj *rancher.OwnedObject, opts Options, now time.Time) Decision {
+	if opts.Finished != nil && obj.RunID != "" && opts.Finished(obj.Cluster, obj.RunID) {
+		return Decision{Reap: true, Reason: fmt.Sprintf("run %s finished", obj.RunID)}
+	}
+	if !obj.ExpiresAt.IsZero() && now.After(obj.ExpiresAt) {
+		return Decision{Reap: true, Reason: "expired at " + obj.ExpiresAt.Format(time.RFC3339)}
+	}
+	if obj.CreatedAt.IsZero() {
+		return Decision{Reason: "creation time unknown"}
+	}
+	age := now.Sub(obj.CreatedAt).Round(time.Minute)
+	if age > opts.TTL {
+		return Decision{Reap: true, Reason: fmt.Sprintf("age %s exceeds TTL %s", age, opts.TTL)}
+	}
+	return Decision{Reason: fmt.Sprintf("age %s within TTL %s", age, opts.TTL)}
+}
+
+// Run lists this tool's objects in Rancher and reaps the ones Decide
+// selects: clusters first, then, once each cluster is gone, its cloud
+// credential and machine configs.
+func Run(ctx context.Context, api API, opts Options, w io.Writer) error {
+	objects, err := api.ListOwned()
+	if err != nil {
+		return err
+	}
+	decisions := Decide(objects, opts, time.Now())
+	printDecisions(w, decisions, opts.DryRun)
+	if opts.DryRun {
+		return nil
+	}
+
+	var failed int
+	reapedClusters := map[string]bool{}
+	for _, d := range decisions {
+		if d.Reap && d.Object.Kind == "cluster" {
+			if err := api.DeleteOwned(d.Object); err != nil {
+				fmt.Fprintln(w, "  Error:", err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(w, "  Deleted %s\n", d.Object)
+			reapedClusters[d.Object.Cluster] = true
+		}
+	}
+
+	remaining := waitForClusters(ctx, api, reapedClusters, opts, w)
+
+	for _, d := range decisions {
+		if !d.Reap || d.Object.Kind == "cluster" {
+			continue
+		}
+		if remaining[d.Object.Cluster] {
+			fmt.Fprintf(w, "  Skipping %s: cluster %s is still being removed; reap again later\n", d.Object, d.Object.Cluster)
+			continue
+		}
+		if err := api.DeleteOwned(d.Object); err != nil {
+			fmt.Fprintln(w, "  Error:", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "  Deleted %s\n", d.Object)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d object(s) could not be deleted", failed)
+	}
+	return nil
+}
+
+// waitForClusters polls until the deleted clusters are gone or opts.Wait
+// passes, returning the ones still present.
+func waitForClusters(ctx context.Context, api API, deleted map[string]bool, opts Options, w io.Writer) map[string]bool {
+	remaining := map[string]bool{}
+	for name := range deleted {
+		remaining[name] = true
+	}
+	if len(remaining) == 0 {
+		return remaining
+	}
+
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	deadline := time.Now().Add(opts.Wait)
+	fmt.Fprintf(w, "  Waiting up to %s for %d cluster(s) to be removed...\n", opts.Wait, len(remaining))
+	for {
+		objects, err := api.ListOwned()
+		if err == nil {
+			present := map[string]bool{}
+			for _, obj := range objects {
+				if obj.Kind == "cluster" {
+					present[obj.Cluster] = true
+				}
+			}
+			for name := range remaining {
+				if !present[name] {
+					delete(remaining, name)
+				}
+			}
+		}
+		if len(remaining) == 0 || time.Now().After(deadline) {
+			return remaining
+		}
+		select {
+		case <-ctx.Done():
+			return remaining
+		case <-time.After(interval):
+		}
+	}
+}
+
+func printDecisions(w io.Writer, decisions []Decision, dryRun bool) {
+	if len(decisions) == 0 {
+		fmt.Fprintln(w, "No objects created by this tool found")
+		return
+	}
+	verb := "DELETE"
+	if dryRun {
+		verb = "WOULD DELETE"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tKIND\tNAME\tCLUSTER\tRUN\tOWNER\tCREATED\tREASON")
+	for _, d := range decisions {
+		action := "keep"
+		if d.Reap {
+			action = verb
+		}
+		created := "-"
+		if !d.Object.CreatedAt.IsZero() {
+			created = d.Object.CreatedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", action, d.Object.Kind, d.Object.Name,
+			dash(d.Object.Cluster), dash(d.Object.RunID), dash(d.Object.Owner), created, d.Reason)
+	}
+	tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,275 @@
+package reaper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/rancher"
+)
+
+const (
+	clustersPath = "/v1/provisioning.cattle.io.clusters/" + rancher.ProvisioningNamespace
+	configsPath  = "/v1/rke-machine-config.cattle.io.digitaloceanconfigs/" + rancher.ProvisioningNamespace
+	credsPath    = "/v3/cloudcredentials"
+)
+
+// pageSize is small so every list spans several pages.
+const pageSize = 2
+
+type object map[string]interface{}
+
+// fakeRancher serves the parts of the Rancher API the reaper uses. Deleted
+// clusters stay listed once more, like Rancher removing their machines
+// first. events records deletions and cluster removals in order.
+type fakeRancher struct {
+	mu          sync.Mutex
+	collections map[string][]object
+	removing    map[string]bool
+	events      []string
+}
+
+// newFakeRancher seeds owned clusters that are old, fresh and expired, an
+// unowned cluster and credential, and an orphaned credential whose cluster
+// is already gone.
+func newFakeRancher(t *testing.T, now time.Time) (*fakeRancher, *rancher.Client) {
+	f := &fakeRancher{collections: map[string][]object{}, removing: map[string]bool{}}
+	add := func(cluster, runID string, age, ttl time.Duration) {
+		owner := rancher.Ownership{Cluster: cluster, RunID: runID, Owner: "ci", CreatedAt: now.Add(-age), ExpiresAt: now.Add(ttl - age)}
+		labels, annotations := owner.Labels(), owner.Annotations()
+		f.collections[clustersPath] = append(f.collections[clustersPath], steveObject(cluster, labels, annotations))
+		f.collections[configsPath] = append(f.collections[configsPath], steveObject(cluster+"-do-pool", labels, annotations))
+		f.collections[credsPath] = append(f.collections[credsPath], normanObject("cc-"+cluster, cluster+"-cred", labels, annotations))
+	}
+	add("old-test", "run-old", 72*time.Hour, 48*time.Hour)
+	add("fresh-test", "run-fresh", time.Hour, 4*time.Hour)
+	add("expired-test", "run-expired", 3*time.Hour, 2*time.Hour)
+
+	f.collections[clustersPath] = append(f.collections[clustersPath], steveObject("someone-elses-cluster", nil, nil))
+	f.collections[credsPath] = append(f.collections[credsPath], normanObject("cc-other", "someone-elses-cred", nil, nil))
+	gone := rancher.Ownership{Cluster: "gone-test", RunID: "run-gone", CreatedAt: now.Add(-30 * time.Hour)}
+	f.collections[credsPath] = append(f.collections[credsPath], normanObject("cc-gone", "gone-test-cred", gone.Labels(), gone.Annotations()))
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client, err := rancher.NewClient(srv.URL, "token-fake:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+func steveObject(name string, labels, annotations map[string]string) object {
+	return object{
+		"id": rancher.ProvisioningNamespace + "/" + name,
+		"metadata": object{
+			"name":        name,
+			"namespace":   rancher.ProvisioningNamespace,
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	}
+}
+
+func normanObject(id, name string, labels, annotations map[string]string) object {
+	return object{"id": id, "name": name, "labels": labels, "annotations": annotations}
+}
+
+// key is the last path segment addressing an object: the metadata name
+// for steve objects, the ID for v3 ones.
+func key(obj object) string {
+	if meta, ok := obj["metadata"].(object); ok {
+		return meta["name"].(string)
+	}
+	return obj["id"].(string)
+}
+
+func (f *fakeRancher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if path == "/v3" {
+		// norman reads the schema list from here; the reaper needs none.
+		w.Header().Set("X-API-Schemas", "http://"+r.Host+"/v3")
+		writeJSON(w, object{"type": "collection", "data": []object{}})
+		return
+	}
+
+	for collection, objects := range f.collections {
+		switch {
+		case path == collection && r.Method == http.MethodGet:
+			writeJSON(w, page(r, collection, objects))
+			if collection == clustersPath {
+				f.removeDeletedClusters()
+			}
+			return
+		case strings.HasPrefix(path, collection+"/") && r.Method == http.MethodDelete:
+			name := strings.TrimPrefix(path, collection+"/")
+			for i, obj := range objects {
+				if key(obj) != name {
+					continue
+				}
+				f.events = append(f.events, "delete "+name)
+				if collection == clustersPath {
+					f.removing[name] = true
+				} else {
+					f.collections[collection] = append(objects[:i:i], objects[i+1:]...)
+				}
+				return
+			}
+		}
+	}
+	http.Error(w, `{"type":"error","status":404,"code":"NotFound"}`, http.StatusNotFound)
+}
+
+// page serves pageSize objects from the offset in the request: steve
+// lists hand out a continue token, norman ones a pagination.next URL.
+func page(r *http.Request, collection string, objects []object) object {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("continue") + r.URL.Query().Get("marker"))
+	end := min(offset+pageSize, len(objects))
+	resp := object{"type": "collection", "data": objects[offset:end]}
+	if end == len(objects) {
+		return resp
+	}
+	if collection == credsPath {
+		resp["pagination"] = object{"next": fmt.Sprintf("http://%s%s?marker=%d", r.Host, collection, end)}
+	} else {
+		resp["continue"] = strconv.Itoa(end)
+	}
+	return resp
+}
+
+// removeDeletedClusters drops the clusters deleted before the list just
+// served.
+func (f *fakeRancher) removeDeletedClusters() {
+	f.collections[clustersPath] = slices.DeleteFunc(f.collections[clustersPath], func(obj object) bool {
+		if f.removing[key(obj)] {
+			f.events = append(f.events, "removed "+key(obj))
+			return true
+		}
+		return false
+	})
+	clear(f.removing)
+}
+
+func (f *fakeRancher) deleted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, e := range f.events {
+		if name, ok := strings.CutPrefix(e, "delete "); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func reaped(decisions []Decision) []string {
+	var names []string
+	for _, d := range decisions {
+		if d.Reap {
+			names = append(names, d.Object.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestDecide(t *testing.T) {
+	now := time.Now()
+	_, client := newFakeRancher(t, now)
+	objects, err := client.ListOwned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Name, "someone-elses") {
+			t.Errorf("ListOwned returned unowned %s", obj)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "expired and past TTL",
+			opts: Options{TTL: 48 * time.Hour},
+			want: []string{"expired-test", "expired-test-cred", "expired-test-do-pool", "old-test", "old-test-cred", "old-test-do-pool"},
+		},
+		{
+			name: "orphan past TTL",
+			opts: Options{TTL: 24 * time.Hour},
+			want: []string{"expired-test", "expired-test-cred", "expired-test-do-pool", "gone-test-cred", "old-test", "old-test-cred", "old-test-do-pool"},
+		},
+		{
+			name: "finished run",
+			opts: Options{TTL: 48 * time.Hour, Finished: func(cluster, runID string) bool {
+				return cluster == "fresh-test" && runID == "run-fresh"
+			}},
+			want: []string{"expired-test", "expired-test-cred", "expired-test-do-pool", "fresh-test", "fresh-test-cred", "fresh-test-do-pool", "old-test", "old-test-cred", "old-test-do-pool"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reaped(Decide(objects, tt.opts, now)); !slices.Equal(got, tt.want) {
+				t.Errorf("reaped %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	fake, client := newFakeRancher(t, time.Now())
+
+	var out bytes.Buffer
+	if err := Run(context.Background(), client, Options{TTL: 24 * time.Hour, DryRun: true}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := fake.deleted(); len(deleted) > 0 {
+		t.Errorf("dry run deleted %q", deleted)
+	}
+	if !strings.Contains(out.String(), "WOULD DELETE  cluster") {
+		t.Errorf("dry run output lacks WOULD DELETE rows:\n%s", out.String())
+	}
+}
+
+func TestRunDeletionOrder(t *testing.T) {
+	fake, client := newFakeRancher(t, time.Now())
+
+	var out bytes.Buffer
+	opts := Options{TTL: 48 * time.Hour, Wait: 5 * time.Second, PollInterval: 10 * time.Millisecond}
+	if err := Run(context.Background(), client, opts, &out); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	want := []string{
+		"delete expired-test",
+		"delete old-test",
+		"removed old-test",
+		"removed expired-test",
+		"delete cc-expired-test",
+		"delete expired-test-do-pool",
+		"delete cc-old-test",
+		"delete old-test-do-pool",
+	}
+	if !slices.Equal(fake.events, want) {
+		t.Errorf("events:\n  %s\nwant:\n  %s", strings.Join(fake.events, "\n  "), strings.Join(want, "\n  "))
+	}
+}
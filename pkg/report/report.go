@@ -0,0 +1,109 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/diagnostics"
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/terraform"
+)
+
+// Report is the machine-readable summary of a run, written next to any
+// diagnostics bundle so CI can archive and inspect it.
+type Report struct {
+	RunID       string    `json:"run_id"`
+	ClusterName string    `json:"cluster_name"`
+	ClusterID   string    `json:"cluster_id,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Passed      bool      `json:"passed"`
+	// Terraform is the CLI and version used, e.g. "tofu 1.8.3".
+	Terraform string `json:"terraform,omitempty"`
+	// IngressControllers describes the downstream cluster's ingress
+	// controllers, e.g. "traefik 3.3.6 (rancher/mirrored-library-traefik:3.3.6 in kube-system)".
+	IngressControllers []string `json:"ingress_controllers,omitempty"`
+
+	TerraformRetries []terraform.Retry      `json:"terraform_retries,omitempty"`
+	AgentLogs        []diagnostics.AgentLog `json:"agent_logs,omitempty"`
+}
+
+// New starts a report for a run.
+func New(runID, clusterName string) *Report {
+	return &Report{
+		RunID:       runID,
+		ClusterName: clusterName,
+		StartedAt:   time.Now().UTC(),
+	}
+}
+
+// Finish records the end of the run and its outcome.
+func (r *Report) Finish(passed bool) {
+	r.FinishedAt = time.Now().UTC()
+	r.Passed = passed
+}
+
+// Write saves the report as <dir>/<cluster>-<run-id>-report.json and
+// returns its path.
+func (r *Report) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create artifacts dir: %w", err)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-report.json", r.ClusterName, r.RunID))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("write report: %w", err)
+	}
+	return path, nil
+}
+
+// Print writes a human-readable summary of the report.
+func (r *Report) Print(w io.Writer) {
+	result := "FAILED"
+	if r.Passed {
+		result = "PASSED"
+	}
+	fmt.Fprintf(w, "\nRun %s: %s in %s\n", r.RunID, result, r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	if r.Terraform != "" {
+		fmt.Fprintf(w, "Terraform: %s\n", r.Terraform)
+	}
+	for _, c := range r.IngressControllers {
+		fmt.Fprintf(w, "Ingress controller: %s\n", c)
+	}
+
+	if len(r.TerraformRetries) > 0 {
+		fmt.Fprintln(w, "Terraform retries:")
+		for _, retry := range r.TerraformRetries {
+			fmt.Fprintf(w, "  %s attempt %d: %s (retried after %ds)\n", retry.Op, retry.Attempt, retry.Cause, retry.DelaySeconds)
+		}
+	}
+
+	if len(r.AgentLogs) > 0 {
+		fmt.Fprintln(w, "Rancher agent logs:")
+		for _, l := range r.AgentLogs {
+			fmt.Fprintf(w, "  %-60s %s\n", l.Source(), l.Summary())
+			names := make([]string, 0, len(l.Examples))
+			for name := range l.Examples {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(w, "      %s: %s\n", name, truncate(l.Examples[name], 160))
+			}
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
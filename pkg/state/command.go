@@ -0,0 +1,124 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the state subcommand.
+const Usage = `usage: state <command> [cluster]
+
+  list             list clusters with recorded state (default)
+  show <cluster>   print a cluster's record and step history as JSON
+  reset <cluster>  forget a cluster's state so the next run starts over
+  unlock <cluster> release a lock left by a run that is gone
+`
+
+// RunCommand implements the state subcommand.
+func RunCommand(s *Store, args []string, w io.Writer) error {
+	cmd := "list"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "list", "show", "reset", "unlock":
+	default:
+		return fmt.Errorf("unknown state command %q\n\n%s", cmd, Usage)
+	}
+	if cmd != "list" && len(args) != 2 {
+		return fmt.Errorf("%s needs a cluster name\n\n%s", cmd, Usage)
+	}
+
+	switch cmd {
+	case "list":
+		return listRecords(s, w)
+
+	case "show":
+		rec, err := s.Load(args[1])
+		if err != nil {
+			return err
+		}
+		holder, err := s.LockHolder(args[1])
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(struct {
+			*Record
+			Lock *LockInfo `json:"lock,omitempty"`
+		}{rec, holder}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+
+	case "reset":
+		lock, err := s.Lock(args[1], "state-reset")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+		if err := s.Delete(args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "State for %s reset\n", args[1])
+		return nil
+
+	case "unlock":
+		holder, err := s.LockHolder(args[1])
+		if err != nil {
+			fmt.Fprintln(w, "Warning:", err)
+		}
+		if err := s.Unlock(args[1]); err != nil {
+			return err
+		}
+		if holder != nil {
+			fmt.Fprintf(w, "Released lock held by %s\n", holder)
+		} else {
+			fmt.Fprintf(w, "Lock for %s released\n", args[1])
+		}
+	}
+	return nil
+}
+
+func listRecords(s *Store, w io.Writer) error {
+	records, err := s.List()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(w, "No cluster state in %s\n", s.Dir)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tDEPLOYED\tUPGRADED\tID\tVERSION\tLAST STEP\tLOCKED BY")
+	for _, rec := range records {
+		lastStep := "-"
+		if n := len(rec.History); n > 0 {
+			step := rec.History[n-1]
+			lastStep = fmt.Sprintf("%s (%s)", step.Name, step.At.Local().Format(time.DateTime))
+		}
+		lockedBy := "-"
+		if holder, err := s.LockHolder(rec.Cluster); err != nil {
+			lockedBy = "unreadable lock"
+		} else if holder != nil && holder.RunID == "" {
+			lockedBy = "starting run"
+		} else if holder != nil {
+			lockedBy = fmt.Sprintf("%s (pid %d on %s)", holder.RunID, holder.PID, holder.Host)
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%s\t%s\t%s\t%s\n", rec.Cluster, rec.ClusterDeployed, rec.ClusterUpgraded,
+			dash(rec.ClusterID), dash(rec.CurrentVersion), lastStep, lockedBy)
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,194 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// LockInfo identifies the run holding a cluster's lock.
+type LockInfo struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	RunID    string    `json:"run_id"`
+	Acquired time.Time `json:"acquired"`
+}
+
+func (i *LockInfo) String() string {
+	if i.RunID == "" && i.PID == 0 {
+		return "a run that has not recorded itself yet"
+	}
+	return fmt.Sprintf("run %s (pid %d on %s, since %s)", i.RunID, i.PID, i.Host, i.Acquired.Format(time.RFC3339))
+}
+
+// LockedError is returned when another run holds the cluster's lock.
+type LockedError struct {
+	Cluster string
+	Holder  *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if host, _ := os.Hostname(); e.Holder.Host != "" && e.Holder.Host != host {
+		return fmt.Sprintf("cluster %s is locked by %s; if that run is gone, release it with `state unlock %s`", e.Cluster, e.Holder, e.Cluster)
+	}
+	return fmt.Sprintf("cluster %s is locked by %s", e.Cluster, e.Holder)
+}
+
+// Lock is an exclusive hold on one cluster's state.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+func (s *Store) lockPath(cluster string) string {
+	return strings.TrimSuffix(s.recordPath(cluster), ".json") + ".lock"
+}
+
+// Lock takes the cluster's lock for this process. The lock file is held
+// with an OS file lock, which the kernel drops when the process dies, so a
+// file left by a dead run on this host is taken over. A file naming
+// another host can't be checked and is only released with Unlock.
+func (s *Store) Lock(cluster, runID string) (*Lock, error) {
+	host, _ := os.Hostname()
+	info := LockInfo{PID: os.Getpid(), Host: host, RunID: runID, Acquired: time.Now().UTC()}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	path := s.lockPath(cluster)
+	lastErr := fmt.Errorf("could not lock state for cluster %s", cluster)
+	// A few attempts ride out another process briefly probing the lock or
+	// releasing it as we open it.
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open state lock: %w", err)
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock state: %w", err)
+		}
+		if !locked {
+			f.Close()
+			lastErr = &LockedError{Cluster: cluster, Holder: readLockInfo(path)}
+			continue
+		}
+		if !sameFile(f, path) {
+			// Released and removed between our open and lock.
+			f.Close()
+			continue
+		}
+
+		if prev := readLockInfo(path); prev.Host != "" && prev.Host != host {
+			unlockFile(f)
+			f.Close()
+			return nil, &LockedError{Cluster: cluster, Holder: prev}
+		} else if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			fmt.Printf("  Taking over stale state lock from %s\n", prev)
+		}
+		if err := writeLockInfo(f, data); err != nil {
+			os.Remove(path)
+			f.Close()
+			return nil, fmt.Errorf("write state lock: %w", err)
+		}
+		return &Lock{path: path, file: f}, nil
+	}
+	return nil, lastErr
+}
+
+func writeLockInfo(f *os.File, data []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readLockInfo returns what the lock file says about its holder. A missing,
+// empty or partly written file yields an empty LockInfo.
+func readLockInfo(path string) *LockInfo {
+	info := &LockInfo{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, info)
+	}
+	return info
+}
+
+// sameFile reports whether f is still the file at path.
+func sameFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, current)
+}
+
+// LockHolder returns who holds the cluster's lock, or nil if it is free. A
+// lock whose holder hasn't written its details yet is returned with an
+// empty LockInfo.
+func (s *Store) LockHolder(cluster string) (*LockInfo, error) {
+	path := s.lockPath(cluster)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state lock: %w", err)
+	}
+	defer f.Close()
+
+	locked, err := tryLockFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("read state lock: %w", err)
+	}
+	info := readLockInfo(path)
+	if !locked {
+		return info, nil
+	}
+	unlockFile(f)
+	if host, _ := os.Hostname(); info.Host != "" && info.Host != host {
+		return info, nil
+	}
+	return nil, nil
+}
+
+// Unlock force-releases the cluster's lock, whoever holds it.
+func (s *Store) Unlock(cluster string) error {
+	if err := os.Remove(s.lockPath(cluster)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove state lock: %w", err)
+	}
+	return nil
+}
+
+// Release gives up the lock. The file is removed before it is closed, so a
+// run that opened it in between sees it was replaced instead of locking a
+// file nobody else can find.
+func (l *Lock) Release() error {
+	err := os.Remove(l.path)
+	l.file.Close()
+	if err != nil && !os.IsNotExist(err) {
+		// Windows can't remove a file that is still open.
+		err = os.Remove(l.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("release state lock: %w", err)
+	}
+	return nil
+}
+
+// Locked reports whether a run holds the cluster's lock. Locks naming
+// another host, or unreadable ones, count as held.
+func (s *Store) Locked(cluster string) bool {
+	holder, err := s.LockHolder(cluster)
+	return err != nil || holder != nil
+}
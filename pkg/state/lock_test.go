@@ -0,0 +1,159 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeLockFile(t *testing.T, s *Store, cluster string, info LockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.lockPath(cluster), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockRelease(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	lock, err := s.Lock("c1", "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := s.LockHolder("c1")
+	if err != nil || holder == nil || holder.RunID != "run-1" || holder.PID != os.Getpid() {
+		t.Fatalf("LockHolder = %+v, %v; want run-1 in this process", holder, err)
+	}
+	if !s.Locked("c1") {
+		t.Error("Locked = false while held")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.lockPath("c1")); !os.IsNotExist(err) {
+		t.Errorf("lock file left after Release: %v", err)
+	}
+	if s.Locked("c1") {
+		t.Error("Locked = true after Release")
+	}
+}
+
+func TestLockLiveHolder(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	lock, err := s.Lock("c1", "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+
+	_, err = s.Lock("c1", "run-2")
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second Lock = %v, want *LockedError", err)
+	}
+	if locked.Holder.RunID != "run-1" {
+		t.Errorf("holder = %s, want run-1", locked.Holder)
+	}
+}
+
+func TestLockStaleHolder(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	host, _ := os.Hostname()
+	writeLockFile(t, s, "c1", LockInfo{PID: 1 << 22, Host: host, RunID: "dead-run", Acquired: time.Now()})
+
+	lock, err := s.Lock("c1", "run-2")
+	if err != nil {
+		t.Fatalf("Lock over a stale lock = %v", err)
+	}
+	defer lock.Release()
+	if holder, _ := s.LockHolder("c1"); holder == nil || holder.RunID != "run-2" {
+		t.Errorf("holder = %v, want run-2", holder)
+	}
+}
+
+// TestLockStaleTakeoverRace has several runs take over the same stale
+// lock at once; exactly one may win.
+func TestLockStaleTakeoverRace(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	host, _ := os.Hostname()
+	writeLockFile(t, s, "c1", LockInfo{PID: 1 << 22, Host: host, RunID: "dead-run", Acquired: time.Now()})
+
+	var wg sync.WaitGroup
+	locks := make(chan *Lock, 8)
+	for i := 0; i < cap(locks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lock, err := s.Lock("c1", "racer"); err == nil {
+				locks <- lock
+			}
+		}()
+	}
+	wg.Wait()
+	close(locks)
+
+	var won int
+	for lock := range locks {
+		won++
+		defer lock.Release()
+	}
+	if won != 1 {
+		t.Errorf("%d runs hold the lock, want 1", won)
+	}
+}
+
+func TestLockForeignHost(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	writeLockFile(t, s, "c1", LockInfo{PID: 1, Host: "some-other-host", RunID: "remote-run", Acquired: time.Now()})
+
+	_, err := s.Lock("c1", "run-2")
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Holder.Host != "some-other-host" {
+		t.Fatalf("Lock = %v, want *LockedError naming some-other-host", err)
+	}
+	if !s.Locked("c1") {
+		t.Error("Locked = false for a foreign-host lock")
+	}
+
+	if err := s.Unlock("c1"); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := s.Lock("c1", "run-2")
+	if err != nil {
+		t.Fatalf("Lock after Unlock = %v", err)
+	}
+	lock.Release()
+	if err := s.Unlock("c1"); err != nil {
+		t.Errorf("Unlock of a free lock = %v", err)
+	}
+}
+
+// TestLockUnwrittenHolder covers a run that holds the lock but hasn't
+// written its details yet.
+func TestLockUnwrittenHolder(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	f, err := os.OpenFile(s.lockPath("c1"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if ok, err := tryLockFile(f); !ok || err != nil {
+		t.Fatalf("tryLockFile = %v, %v", ok, err)
+	}
+
+	holder, err := s.LockHolder("c1")
+	if err != nil || holder == nil {
+		t.Fatalf("LockHolder = %v, %v; want an empty holder", holder, err)
+	}
+	var locked *LockedError
+	if _, err := s.Lock("c1", "run-2"); !errors.As(err, &locked) {
+		t.Errorf("Lock = %v, want *LockedError", err)
+	}
+}
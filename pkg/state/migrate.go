@@ -0,0 +1,112 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// legacyFile is where schema versions 0 and 1 kept all state.
+const legacyFile = "run_state.json"
+
+// recordMigrations upgrade a raw record from the keyed schema version to
+// the next one.
+var recordMigrations = map[int]func(raw map[string]interface{}){
+	// 0 -> 1: the single record gains a cluster name, set by the caller.
+	0: func(raw map[string]interface{}) {},
+	// 1 -> 2: records move to their own files and gain a step history.
+	1: func(raw map[string]interface{}) {
+		if _, ok := raw["history"]; !ok {
+			raw["history"] = []interface{}{}
+		}
+	},
+}
+
+// migrateRecord upgrades a raw record in place to SchemaVersion.
+func migrateRecord(raw map[string]interface{}) error {
+	version := 0
+	switch v := raw["schema_version"].(type) {
+	case float64:
+		version = int(v)
+	case int:
+		version = v
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("state schema version %d is newer than this tool supports (%d)", version, SchemaVersion)
+	}
+	for ; version < SchemaVersion; version++ {
+		migrate, ok := recordMigrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from state schema version %d", version)
+		}
+		migrate(raw)
+	}
+	raw["schema_version"] = SchemaVersion
+	return nil
+}
+
+// migrateLegacy imports a version 0 or 1 run_state.json into the store and
+// renames it so it is only imported once. Records already in the store win.
+// A version 0 file holds one unnamed record, which is assigned to cluster;
+// without a cluster the file is left for a later run to migrate.
+func (s *Store) migrateLegacy(path, cluster string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var legacy map[string]json.RawMessage
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("parse %s: %w (fix or remove it)", path, err)
+	}
+
+	var clusters map[string]map[string]interface{}
+	if clustersRaw, ok := legacy["clusters"]; ok {
+		if err := json.Unmarshal(clustersRaw, &clusters); err != nil {
+			return fmt.Errorf("parse %s: %w (fix or remove it)", path, err)
+		}
+		for _, raw := range clusters {
+			raw["schema_version"] = 1
+		}
+	} else {
+		if cluster == "" {
+			return nil
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("parse %s: %w (fix or remove it)", path, err)
+		}
+		raw["schema_version"] = 0
+		clusters = map[string]map[string]interface{}{cluster: raw}
+	}
+
+	for name, raw := range clusters {
+		if _, err := os.Stat(s.recordPath(name)); err == nil {
+			continue
+		}
+		raw["cluster"] = name
+		if err := migrateRecord(raw); err != nil {
+			return err
+		}
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		var rec Record
+		if err := json.Unmarshal(converted, &rec); err != nil {
+			return fmt.Errorf("migrate %s entry %s: %w", path, name, err)
+		}
+		if err := s.Save(&rec); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("  Migrated %d cluster(s) from %s into %s\n", len(clusters), path, s.Dir)
+
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return fmt.Errorf("rename %s after migration: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateLegacy(t *testing.T) {
+	tests := []struct {
+		name     string
+		legacy   string
+		cluster  string
+		want     map[string]Record
+		migrated bool
+	}{
+		{
+			name:    "version 0",
+			legacy:  `{"cluster_deployed": true, "cluster_upgraded": false, "cluster_id": "c-abc12", "current_version": "v1.32.4+k3s1"}`,
+			cluster: "my-test",
+			want: map[string]Record{
+				"my-test": {ClusterDeployed: true, ClusterID: "c-abc12", CurrentVersion: "v1.32.4+k3s1"},
+			},
+			migrated: true,
+		},
+		{
+			name:   "version 0 without a cluster",
+			legacy: `{"cluster_deployed": true, "cluster_id": "c-abc12"}`,
+		},
+		{
+			name:    "version 1",
+			legacy:  `{"clusters": {"a": {"cluster_deployed": true, "cluster_id": "c-a"}, "b": {"cluster_upgraded": true, "cluster_id": "c-b"}}}`,
+			cluster: "ignored",
+			want: map[string]Record{
+				"a": {ClusterDeployed: true, ClusterID: "c-a"},
+				"b": {ClusterUpgraded: true, ClusterID: "c-b"},
+			},
+			migrated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &Store{Dir: filepath.Join(dir, "state")}
+			if err := os.MkdirAll(s.Dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, legacyFile)
+			if err := os.WriteFile(path, []byte(tt.legacy), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.migrateLegacy(path, tt.cluster); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.want) {
+				t.Fatalf("got %d records, want %d", len(records), len(tt.want))
+			}
+			for _, rec := range records {
+				want, ok := tt.want[rec.Cluster]
+				if !ok {
+					t.Errorf("unexpected record for %s", rec.Cluster)
+					continue
+				}
+				if rec.SchemaVersion != SchemaVersion || rec.ClusterDeployed != want.ClusterDeployed ||
+					rec.ClusterUpgraded != want.ClusterUpgraded || rec.ClusterID != want.ClusterID ||
+					rec.CurrentVersion != want.CurrentVersion {
+					t.Errorf("record %s = %+v, want %+v", rec.Cluster, rec, want)
+				}
+			}
+
+			_, err = os.Stat(path + ".migrated")
+			if migrated := err == nil; migrated != tt.migrated {
+				t.Errorf("renamed to .migrated = %v, want %v", migrated, tt.migrated)
+			}
+			if _, err := os.Stat(path); (err == nil) == tt.migrated {
+				t.Errorf("legacy file still present = %v, want %v", err == nil, !tt.migrated)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyKeepsExistingRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := &Store{Dir: dir}
+	if err := s.Save(&Record{Cluster: "my-test", ClusterID: "c-current"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, legacyFile)
+	if err := os.WriteFile(path, []byte(`{"cluster_deployed": true, "cluster_id": "c-old"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.migrateLegacy(path, "my-test"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := s.Load("my-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ClusterID != "c-current" {
+		t.Errorf("cluster ID = %s, want the existing c-current", rec.ClusterID)
+	}
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/terraform"
+)
+
+// Observed is what terraform and Rancher currently say about a cluster.
+type Observed struct {
+	// Terraform is the cluster in terraform state, nil if there is none.
+	Terraform *terraform.StateCluster
+	// RancherFound is whether Rancher has the provisioning cluster, with
+	// its v1 cluster ID, spec.kubernetesVersion and readiness.
+	RancherFound     bool
+	RancherClusterID string
+	RancherVersion   string
+	RancherReady     bool
+}
+
+// Reconcile overwrites the record's cluster fields with what terraform and
+// Rancher report, keeping its history. upgradeVersion is the run's target
+// version ("" when not upgrading). It returns a description of every way
+// the recorded state disagreed with reality.
+func Reconcile(rec *Record, observed Observed, upgradeVersion string) []string {
+	var drift []string
+	recorded := *rec
+	derived := rec
+	derived.ClusterDeployed, derived.ClusterUpgraded = false, false
+	derived.ClusterID, derived.CurrentVersion = "", ""
+
+	tf := observed.Terraform
+	switch {
+	case tf != nil && observed.RancherFound:
+		derived.ClusterDeployed = true
+	case tf != nil:
+		drift = append(drift, fmt.Sprintf("cluster %s is in terraform state but not in Rancher (deleted outside terraform?); it will be recreated", tf.Name))
+	case observed.RancherFound:
+		drift = append(drift, "cluster exists in Rancher but not in terraform state; terraform cannot manage it until it is imported or deleted")
+	}
+
+	if derived.ClusterDeployed {
+		derived.ClusterID = observed.RancherClusterID
+		if derived.ClusterID == "" {
+			derived.ClusterID = tf.ClusterID
+		}
+		derived.CurrentVersion = observed.RancherVersion
+		if tf.KubernetesVersion != "" && tf.KubernetesVersion != observed.RancherVersion {
+			drift = append(drift, fmt.Sprintf("terraform state has kubernetes_version %s but Rancher has %s", tf.KubernetesVersion, observed.RancherVersion))
+		}
+		// Only count the upgrade as done once Rancher has rolled it out;
+		// otherwise the run picks it up again and waits for it.
+		derived.ClusterUpgraded = upgradeVersion != "" && observed.RancherVersion == upgradeVersion && observed.RancherReady
+	}
+
+	if recorded.ClusterDeployed != derived.ClusterDeployed {
+		drift = append(drift, fmt.Sprintf("run state says cluster_deployed=%v, actual %v", recorded.ClusterDeployed, derived.ClusterDeployed))
+	}
+	if recorded.ClusterUpgraded != derived.ClusterUpgraded {
+		drift = append(drift, fmt.Sprintf("run state says cluster_upgraded=%v, actual %v", recorded.ClusterUpgraded, derived.ClusterUpgraded))
+	}
+	if recorded.ClusterID != "" && recorded.ClusterID != derived.ClusterID {
+		drift = append(drift, fmt.Sprintf("run state has cluster ID %s, actual %q", recorded.ClusterID, derived.ClusterID))
+	}
+	if recorded.CurrentVersion != "" && recorded.CurrentVersion != derived.CurrentVersion {
+		drift = append(drift, fmt.Sprintf("run state has version %s, actual %q", recorded.CurrentVersion, derived.CurrentVersion))
+	}
+	return drift
+}
@@ -0,0 +1,176 @@
+// Package state keeps per-cluster run state across runs: what has been
+// deployed and upgraded, and a history of completed steps.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the record files this code writes.
+//
+//	0: flat run_state.json holding one unnamed cluster
+//	1: run_state.json with a "clusters" map
+//	2: one file per cluster under the store dir, with step history
+const SchemaVersion = 2
+
+// Step is a completed step of a run.
+type Step struct {
+	Name  string    `json:"name"`
+	RunID string    `json:"run_id,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// Record is one cluster's state.
+type Record struct {
+	SchemaVersion   int       `json:"schema_version"`
+	Cluster         string    `json:"cluster"`
+	ClusterDeployed bool      `json:"cluster_deployed"`
+	ClusterUpgraded bool      `json:"cluster_upgraded"`
+	ClusterID       string    `json:"cluster_id"`
+	CurrentVersion  string    `json:"current_version"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	History         []Step    `json:"history,omitempty"`
+}
+
+// AddStep appends a completed step to the record's history.
+func (r *Record) AddStep(name, runID string) {
+	r.History = append(r.History, Step{Name: name, RunID: runID, At: time.Now().UTC()})
+}
+
+// Store is a directory of per-cluster record and lock files.
+type Store struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Open returns the store in dir, creating it and migrating a legacy
+// run_state.json from the current directory if there is one. The oldest
+// format's single record is assigned to legacyCluster; pass "" to leave
+// such a file for a run that knows its cluster.
+func Open(dir, legacyCluster string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	s := &Store{Dir: dir}
+	if err := s.migrateLegacy(legacyFile, legacyCluster); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) recordPath(cluster string) string {
+	return filepath.Join(s.Dir, unsafeFileChars.ReplaceAllString(cluster, "_")+".json")
+}
+
+// Load returns the cluster's record, or an empty one if none exists.
+func (s *Store) Load(cluster string) (*Record, error) {
+	rec, err := s.read(s.recordPath(cluster))
+	if os.IsNotExist(err) {
+		return &Record{SchemaVersion: SchemaVersion, Cluster: cluster}, nil
+	}
+	return rec, err
+}
+
+func (s *Store) read(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := migrateRecord(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &rec, nil
+}
+
+// Save writes the record atomically.
+func (s *Store) Save(rec *Record) error {
+	rec.SchemaVersion = SchemaVersion
+	rec.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.recordPath(rec.Cluster)
+	tmp, err := os.CreateTemp(s.Dir, ".record-*")
+	if err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the cluster's record, history included.
+func (s *Store) Delete(cluster string) error {
+	if err := os.Remove(s.recordPath(cluster)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete state: %w", err)
+	}
+	return nil
+}
+
+// List returns every record in the store, sorted by cluster name.
+func (s *Store) List() ([]*Record, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read state dir: %w", err)
+	}
+	var records []*Record
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		rec, err := s.read(filepath.Join(s.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Cluster < records[j].Cluster })
+	return records, nil
+}
+
+// RunFinished reports whether runID is known to have run against the
+// cluster from this store and no run holds the cluster now. Runs this store
+// has never seen are not considered finished.
+func (s *Store) RunFinished(cluster, runID string) bool {
+	rec, err := s.Load(cluster)
+	if err != nil || s.Locked(cluster) {
+		return false
+	}
+	for _, step := range rec.History {
+		if step.RunID == runID {
+			return true
+		}
+	}
+	return false
+}
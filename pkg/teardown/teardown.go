@@ -0,0 +1,98 @@
+// Package teardown checks that destroying a cluster left nothing behind in
+// Rancher or at the cloud provider.
+package teardown
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Check lists what is left of a cluster in one place.
+type Check struct {
+	Name      string
+	Leftovers func() ([]string, error)
+}
+
+// Options bound how long Verify waits for asynchronous cleanup.
+type Options struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// LeakError lists what was still present when Verify gave up, per check.
+// A check whose last attempt failed is reported with its error instead.
+type LeakError struct {
+	Timeout   time.Duration
+	Leftovers map[string][]string
+	Errors    map[string]error
+}
+
+func (e *LeakError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "teardown incomplete after %s:", e.Timeout)
+	for _, name := range slices.Sorted(maps.Keys(e.Leftovers)) {
+		for _, l := range e.Leftovers[name] {
+			fmt.Fprintf(&b, "\n  %s: %s still exists", name, l)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(e.Errors)) {
+		fmt.Fprintf(&b, "\n  %s: could not verify: %v", name, e.Errors[name])
+	}
+	return b.String()
+}
+
+// Verify runs the checks until all report nothing left or opts.Timeout
+// passes. Rancher removes machines and the cloud deletes instances
+// asynchronously, so leftovers right after a destroy are expected.
+func Verify(ctx context.Context, checks []Check, opts Options, w io.Writer) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	deadline := time.Now().Add(opts.Timeout)
+
+	pending := checks
+	leak := &LeakError{Timeout: opts.Timeout}
+	for {
+		leak.Leftovers, leak.Errors = map[string][]string{}, map[string]error{}
+		var still []Check
+		for _, check := range pending {
+			leftovers, err := check.Leftovers()
+			switch {
+			case err != nil:
+				leak.Errors[check.Name] = err
+			case len(leftovers) > 0:
+				leak.Leftovers[check.Name] = leftovers
+			default:
+				fmt.Fprintf(w, "  %s: nothing left\n", check.Name)
+				continue
+			}
+			still = append(still, check)
+		}
+		pending = still
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return leak
+		}
+		for _, check := range pending {
+			if err := leak.Errors[check.Name]; err != nil {
+				fmt.Fprintf(w, "  %s: %v; retrying\n", check.Name, err)
+			} else {
+				fmt.Fprintf(w, "  %s: waiting for %s\n", check.Name, strings.Join(leak.Leftovers[check.Name], ", "))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return leak
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const backendOverrideFile = "backend_override.tf"
+
+// Backend is a terraform remote state backend shared by all clusters. Each
+// cluster's state lives under its own key/path/address derived from Config.
+type Backend struct {
+	// Type is one of http, s3, consul or pg.
+	Type string
+	// Config holds -backend-config settings common to every cluster, e.g.
+	// bucket and endpoint for s3 or the base address for http.
+	Config map[string]string
+}
+
+// ValidateBackendType returns an error for backends we don't know how to
+// key per cluster.
+func ValidateBackendType(backendType string) error {
+	switch backendType {
+	case "http", "s3", "consul", "pg":
+		return nil
+	default:
+		return fmt.Errorf("unsupported terraform backend %q (supported: http, s3, consul, pg)", backendType)
+	}
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9_]`)
+
+// clusterConfig returns the backend settings for one cluster, placing its
+// state alongside, but separate from, every other cluster's.
+func (b *Backend) clusterConfig(clusterName string) map[string]string {
+	cfg := make(map[string]string, len(b.Config)+3)
+	for k, v := range b.Config {
+		cfg[k] = v
+	}
+
+	switch b.Type {
+	case "http":
+		address := strings.TrimSuffix(cfg["address"], "/")
+		cfg["address"] = address + "/" + clusterName
+		for _, k := range []string{"lock_address", "unlock_address"} {
+			base := strings.TrimSuffix(cfg[k], "/")
+			if base == "" {
+				base = address
+			}
+			cfg[k] = base + "/" + clusterName
+		}
+	case "s3":
+		prefix := strings.Trim(cfg["key"], "/")
+		if prefix == "" {
+			prefix = "hosted-rancher-testing"
+		}
+		cfg["key"] = prefix + "/" + clusterName + "/terraform.tfstate"
+	case "consul":
+		prefix := strings.Trim(cfg["path"], "/")
+		if prefix == "" {
+			prefix = "hosted-rancher-testing"
+		}
+		cfg["path"] = prefix + "/" + clusterName
+	case "pg":
+		schema := cfg["schema_name"]
+		if schema == "" {
+			schema = "hosted_rancher_testing"
+		}
+		cfg["schema_name"] = schema + "_" + nonIdentifier.ReplaceAllString(strings.ToLower(clusterName), "_")
+	}
+	return cfg
+}
+
+// configureBackend writes (or removes) the backend override in the work
+// dir and returns the extra init arguments for the cluster's backend.
+func (r *Runner) configureBackend() ([]string, error) {
+	overridePath := filepath.Join(r.WorkDir, backendOverrideFile)
+	if r.Backend == nil {
+		if err := os.Remove(overridePath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove backend override: %w", err)
+		}
+		return nil, nil
+	}
+
+	block := fmt.Sprintf("terraform {\n  backend %q {}\n}\n", r.Backend.Type)
+	if err := os.WriteFile(overridePath, []byte(block), 0644); err != nil {
+		return nil, fmt.Errorf("write backend override: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(r.WorkDir, "terraform.tfstate")); err == nil {
+		fmt.Printf("  Warning: local state in %s is ignored now that a %s backend is configured\n", r.WorkDir, r.Backend.Type)
+	}
+
+	cfg := r.Backend.clusterConfig(r.ClusterName)
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{"-reconfigure"}
+	for _, k := range keys {
+		args = append(args, fmt.Sprintf("-backend-config=%s=%s", k, cfg[k]))
+	}
+	return args, nil
+}
@@ -0,0 +1,202 @@
+package terraform
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestClusterConfigPerCluster(t *testing.T) {
+	tests := []struct {
+		backend Backend
+		key     string
+		want    map[string]string
+	}{
+		{
+			backend: Backend{Type: "http", Config: map[string]string{"address": "http://state.example/state/"}},
+			key:     "address",
+			want: map[string]string{
+				"address":        "http://state.example/state/cluster-a",
+				"lock_address":   "http://state.example/state/cluster-a",
+				"unlock_address": "http://state.example/state/cluster-a",
+			},
+		},
+		{
+			backend: Backend{Type: "s3", Config: map[string]string{"bucket": "tfstate", "key": "/tests/"}},
+			key:     "key",
+			want:    map[string]string{"bucket": "tfstate", "key": "tests/cluster-a/terraform.tfstate"},
+		},
+		{
+			backend: Backend{Type: "s3", Config: map[string]string{"bucket": "tfstate"}},
+			key:     "key",
+			want:    map[string]string{"bucket": "tfstate", "key": "hosted-rancher-testing/cluster-a/terraform.tfstate"},
+		},
+		{
+			backend: Backend{Type: "consul", Config: map[string]string{"address": "consul:8500"}},
+			key:     "path",
+			want:    map[string]string{"address": "consul:8500", "path": "hosted-rancher-testing/cluster-a"},
+		},
+		{
+			backend: Backend{Type: "pg", Config: map[string]string{"conn_str": "postgres://db/state", "schema_name": "tf"}},
+			key:     "schema_name",
+			want:    map[string]string{"conn_str": "postgres://db/state", "schema_name": "tf_cluster_a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend.Type, func(t *testing.T) {
+			shared := maps.Clone(tt.backend.Config)
+			a := tt.backend.clusterConfig("cluster-a")
+			for k, v := range tt.want {
+				if a[k] != v {
+					t.Errorf("%s = %q, want %q", k, a[k], v)
+				}
+			}
+			if b := tt.backend.clusterConfig("cluster-b"); b[tt.key] == a[tt.key] {
+				t.Errorf("clusters share %s %q", tt.key, a[tt.key])
+			}
+			if !maps.Equal(tt.backend.Config, shared) {
+				t.Errorf("shared config modified: %v", tt.backend.Config)
+			}
+		})
+	}
+}
+
+func TestConfigureBackend(t *testing.T) {
+	dir := t.TempDir()
+	r := &Runner{
+		WorkDir:     dir,
+		ClusterName: "cluster-a",
+		Backend:     &Backend{Type: "s3", Config: map[string]string{"bucket": "tfstate", "region": "us-east-1"}},
+	}
+
+	args, err := r.configureBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-reconfigure",
+		"-backend-config=bucket=tfstate",
+		"-backend-config=key=hosted-rancher-testing/cluster-a/terraform.tfstate",
+		"-backend-config=region=us-east-1",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+
+	override := filepath.Join(dir, backendOverrideFile)
+	data, err := os.ReadFile(override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "terraform {\n  backend \"s3\" {}\n}\n"; got != want {
+		t.Errorf("%s = %q, want %q", backendOverrideFile, got, want)
+	}
+
+	r.Backend = nil
+	if args, err = r.configureBackend(); err != nil || args != nil {
+		t.Fatalf("configureBackend without a backend = %q, %v", args, err)
+	}
+	if _, err := os.Stat(override); !os.IsNotExist(err) {
+		t.Errorf("%s not removed without a backend: %v", backendOverrideFile, err)
+	}
+}
+
+// stateServer is a minimal terraform HTTP state backend.
+type stateServer struct {
+	mu     sync.Mutex
+	states map[string][]byte
+	locks  map[string][]byte
+}
+
+func (s *stateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := s.states[key]
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write(data)
+	case http.MethodPost:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.states[key] = data
+	case http.MethodDelete:
+		delete(s.states, key)
+	case "LOCK":
+		if held, ok := s.locks[key]; ok {
+			w.WriteHeader(http.StatusLocked)
+			w.Write(held)
+			return
+		}
+		s.locks[key], _ = io.ReadAll(r.Body)
+	case "UNLOCK":
+		delete(s.locks, key)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// TestHTTPBackend runs terraform against an HTTP backend for two clusters
+// and checks each cluster's state lands at its own address.
+func TestHTTPBackend(t *testing.T) {
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform not in PATH")
+	}
+
+	state := &stateServer{states: map[string][]byte{}, locks: map[string][]byte{}}
+	srv := httptest.NewServer(state)
+	defer srv.Close()
+
+	source := t.TempDir()
+	config := "output \"cluster\" {\n  value = \"test\"\n}\n"
+	if err := os.WriteFile(filepath.Join(source, "main.tf"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &Backend{Type: "http", Config: map[string]string{"address": srv.URL + "/state"}}
+	base := t.TempDir()
+	for _, cluster := range []string{"cluster-a", "cluster-b"} {
+		r := &Runner{
+			SourceDir:   source,
+			WorkDir:     filepath.Join(base, cluster),
+			ClusterName: cluster,
+			Backend:     backend,
+		}
+		if err := r.Init(); err != nil {
+			t.Fatalf("%s: init: %v", cluster, err)
+		}
+		if out, err := r.command("apply", "-auto-approve", "-input=false", "-no-color").CombinedOutput(); err != nil {
+			t.Fatalf("%s: apply: %v\n%s", cluster, err, out)
+		}
+		if _, err := os.Stat(filepath.Join(r.WorkDir, "terraform.tfstate")); err == nil {
+			t.Errorf("%s: state written locally", cluster)
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for _, key := range []string{"/state/cluster-a", "/state/cluster-b"} {
+		if len(state.states[key]) == 0 {
+			t.Errorf("no state stored at %s; have %v", key, slices.Collect(maps.Keys(state.states)))
+		}
+	}
+	if len(state.locks) != 0 {
+		t.Errorf("locks left held: %v", slices.Collect(maps.Keys(state.locks)))
+	}
+}
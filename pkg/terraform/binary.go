@@ -0,0 +1,143 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// Binary is the terraform-compatible CLI a runner invokes.
+type Binary struct {
+	// Name is "terraform" or "tofu".
+	Name    string
+	Path    string
+	Version Version
+}
+
+func (b *Binary) String() string {
+	return fmt.Sprintf("%s %s (%s)", b.Name, b.Version, b.Path)
+}
+
+// BinaryOptions selects which CLI to run.
+type BinaryOptions struct {
+	// Name is "terraform" (default) or "tofu".
+	Name string
+	// Path is an explicit binary to use; it skips the cache and PATH.
+	Path string
+	// CacheDir holds pre-downloaded binaries laid out as
+	// <CacheDir>/<name>/<version>/<name>; the newest one matching
+	// Constraint is used before falling back to PATH.
+	CacheDir string
+	// Constraint the binary's version must satisfy, e.g. ">= 1.6, < 2.0".
+	Constraint string
+}
+
+// ValidateBinaryName returns an error for CLIs we can't drive.
+func ValidateBinaryName(name string) error {
+	switch name {
+	case "terraform", "tofu":
+		return nil
+	default:
+		return fmt.Errorf("unsupported terraform binary %q (supported: terraform, tofu)", name)
+	}
+}
+
+// FindBinary locates the CLI described by opts and checks its version.
+func FindBinary(opts BinaryOptions) (*Binary, error) {
+	if opts.Name == "" {
+		opts.Name = "terraform"
+	}
+	if err := ValidateBinaryName(opts.Name); err != nil {
+		return nil, err
+	}
+	constraint, err := ParseConstraint(opts.Constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	path := opts.Path
+	if path == "" && opts.CacheDir != "" {
+		path, err = findCached(opts.CacheDir, opts.Name, constraint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if path == "" {
+		path, err = exec.LookPath(opts.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s not found in PATH: %w", opts.Name, err)
+		}
+	}
+	// Terraform runs in each cluster's work dir, where a relative path
+	// would no longer point at the binary.
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, fmt.Errorf("resolve %s path: %w", opts.Name, err)
+	}
+
+	version, err := binaryVersion(path)
+	if err != nil {
+		return nil, err
+	}
+	if !constraint.Check(version) {
+		return nil, fmt.Errorf("%s %s at %s does not satisfy version constraint %q", opts.Name, version, path, constraint)
+	}
+	return &Binary{Name: opts.Name, Path: path, Version: version}, nil
+}
+
+// findCached returns the newest cached binary matching constraint, or ""
+// if the cache has none.
+func findCached(cacheDir, name string, constraint *Constraint) (string, error) {
+	exe := name
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+
+	entries, err := os.ReadDir(filepath.Join(cacheDir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s cache: %w", name, err)
+	}
+
+	var best string
+	var bestVersion Version
+	for _, e := range entries {
+		v, err := ParseVersion(e.Name())
+		if err != nil || !e.IsDir() || !constraint.Check(v) {
+			continue
+		}
+		path := filepath.Join(cacheDir, name, e.Name(), exe)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if best == "" || v.Compare(bestVersion) > 0 {
+			best, bestVersion = path, v
+		}
+	}
+	return best, nil
+}
+
+// binaryVersion asks the binary for its version. terraform and tofu both
+// report it as terraform_version in `version -json`.
+func binaryVersion(path string) (Version, error) {
+	cmd := exec.Command(path, "version", "-json")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Version{}, fmt.Errorf("%s version failed: %s", path, stderr.String())
+	}
+
+	var out struct {
+		Version string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Version{}, fmt.Errorf("parse %s version: %w", path, err)
+	}
+	return ParseVersion(out.Version)
+}
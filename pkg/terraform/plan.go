@@ -0,0 +1,232 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const planFile = "upgrade.tfplan"
+
+// ResourceChange is one resource's planned change.
+type ResourceChange struct {
+	Address string
+	Type    string
+	Actions []string
+	// Changed lists the top-level attributes whose known values differ
+	// between before and after. Values that only become unknown (computed
+	// by the provider), at any depth, are not counted as changes.
+	Changed []string
+}
+
+// Deletes reports whether the change destroys the resource, including replacements.
+func (c ResourceChange) Deletes() bool {
+	return slices.Contains(c.Actions, "delete")
+}
+
+func (c ResourceChange) String() string {
+	s := fmt.Sprintf("%s: %s", c.Address, strings.Join(c.Actions, "/"))
+	if len(c.Changed) > 0 {
+		s += " (" + strings.Join(c.Changed, ", ") + ")"
+	}
+	return s
+}
+
+// Plan is a saved terraform plan and the changes it would make.
+type Plan struct {
+	// File is the plan's path from the current directory. Terraform runs
+	// in the work dir, so it is given planFile instead.
+	File    string
+	Changes []ResourceChange
+}
+
+// HasChanges reports whether applying the plan would change anything.
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+type showPlan struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Type    string `json:"type"`
+		Change  struct {
+			Actions      []string               `json:"actions"`
+			Before       map[string]interface{} `json:"before"`
+			After        map[string]interface{} `json:"after"`
+			AfterUnknown map[string]interface{} `json:"after_unknown"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// Plan runs terraform plan with -detailed-exitcode and -json, saves the
+// plan to the work dir and parses its resource changes. The caller must
+// Discard the plan, whether or not it is applied.
+func (r *Runner) Plan() (*Plan, error) {
+	path := filepath.Join(r.WorkDir, planFile)
+	fmt.Println("Running terraform plan...")
+	_, err := r.runJSON("plan", os.Stdout, "plan", "-detailed-exitcode", "-json", "-input=false", "-out="+planFile)
+
+	// Exit code 2 means the plan succeeded and has changes.
+	plan := &Plan{File: path}
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 2) {
+		plan.Discard()
+		return nil, err
+	}
+	if err == nil {
+		return plan, nil
+	}
+
+	show := r.command("show", "-json", planFile)
+	var showOut, showErr bytes.Buffer
+	show.Stdout = &showOut
+	show.Stderr = &showErr
+	if err := show.Run(); err != nil {
+		plan.Discard()
+		return nil, fmt.Errorf("terraform show failed: %s", showErr.String())
+	}
+
+	if plan.Changes, err = parsePlan(showOut.Bytes()); err != nil {
+		plan.Discard()
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Discard removes the saved plan file, which holds the run's credentials.
+// It is safe to call more than once, e.g. after ApplyPlan has removed it.
+func (p *Plan) Discard() {
+	if err := os.Remove(p.File); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Warning: could not remove plan file:", err)
+	}
+}
+
+// parsePlan reads the resource changes from terraform show -json output,
+// skipping no-ops and data source reads.
+func parsePlan(data []byte) ([]ResourceChange, error) {
+	var parsed showPlan
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("parse terraform plan: %w", err)
+	}
+
+	var changes []ResourceChange
+	for _, rc := range parsed.ResourceChanges {
+		if slices.Equal(rc.Change.Actions, []string{"no-op"}) || slices.Equal(rc.Change.Actions, []string{"read"}) {
+			continue
+		}
+		changes = append(changes, ResourceChange{
+			Address: rc.Address,
+			Type:    rc.Type,
+			Actions: rc.Change.Actions,
+			Changed: changedAttributes(rc.Change.Before, rc.Change.After, rc.Change.AfterUnknown),
+		})
+	}
+	return changes, nil
+}
+
+// VerifyUpgradeOnly checks that the plan only changes kubernetes_version on
+// rancher2_cluster_v2 and destroys nothing. Anything else (a provider bump
+// replacing machine pools, a credential change, ...) fails the check before
+// nodes get recreated.
+func (p *Plan) VerifyUpgradeOnly() error {
+	var problems []string
+	upgraded := false
+
+	for _, c := range p.Changes {
+		switch {
+		case c.Deletes():
+			problems = append(problems, "destroys "+c.String())
+		case c.Type != "rancher2_cluster_v2":
+			problems = append(problems, "unexpected change "+c.String())
+		case !slices.Equal(c.Changed, []string{"kubernetes_version"}):
+			problems = append(problems, "unexpected attributes changed "+c.String())
+		default:
+			upgraded = true
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("upgrade plan contains unexpected changes:\n  %s", strings.Join(problems, "\n  "))
+	}
+	if !upgraded {
+		return fmt.Errorf("upgrade plan does not change kubernetes_version")
+	}
+	return nil
+}
+
+func changedAttributes(before, after, afterUnknown map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var changed []string
+	for k := range keys {
+		if !reflect.DeepEqual(before[k], knownAfter(before[k], after[k], afterUnknown[k])) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// knownAfter returns after with its unknown values replaced by their
+// before values. after_unknown mirrors the structure of after, with true
+// at each unknown value, which is null or missing in after itself, so a
+// computed field nested in a block (rke_config[0].machine_pools[0]...)
+// would otherwise show up as a change to the whole block.
+func knownAfter(before, after, unknown interface{}) interface{} {
+	switch u := unknown.(type) {
+	case bool:
+		if u {
+			return before
+		}
+	case map[string]interface{}:
+		b, _ := before.(map[string]interface{})
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			return after
+		}
+		known := make(map[string]interface{}, len(a))
+		for k, v := range a {
+			known[k] = v
+		}
+		for k, uv := range u {
+			v := knownAfter(b[k], a[k], uv)
+			if _, inAfter := a[k]; v != nil || inAfter {
+				known[k] = v
+			}
+		}
+		return known
+	case []interface{}:
+		b, _ := before.([]interface{})
+		a, ok := after.([]interface{})
+		if !ok {
+			return after
+		}
+		known := slices.Clone(a)
+		for i := range known {
+			var bv, uv interface{}
+			if i < len(b) {
+				bv = b[i]
+			}
+			if i < len(u) {
+				uv = u[i]
+			}
+			known[i] = knownAfter(bv, known[i], uv)
+		}
+		return known
+	}
+	return after
+}
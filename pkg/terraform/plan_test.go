@@ -0,0 +1,228 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The testdata/plan-*.json fixtures are terraform show -json output, cut
+// down to resource_changes, for terraform/digitalocean/main.tf planned
+// against a stand-in for the rancher2 provider. That provider plans
+// computed attributes the way rancher2's cluster_v2 does: resource_version
+// and the nested rke_config machine_config api_version become unknown on
+// every update.
+//
+//	plan-upgrade  k3s_version changed
+//	plan-replace  cluster_name changed, replacing every resource
+//	plan-foreign  k3s_version and do_size changed
+//	plan-pools    k3s_version and node_count changed
+//	plan-noop     nothing changed
+func loadPlan(t *testing.T, name string) *Plan {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "plan-"+name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := parsePlan(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Plan{Changes: changes}
+}
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []string
+	}{
+		{
+			fixture: "upgrade",
+			want:    []string{"rancher2_cluster_v2.downstream: update (kubernetes_version)"},
+		},
+		{
+			fixture: "replace",
+			want: []string{
+				"rancher2_cloud_credential.do: delete/create (name)",
+				"rancher2_cluster_sync.downstream: update",
+				"rancher2_cluster_v2.downstream: delete/create (name)",
+				"rancher2_machine_config_v2.do_nodes: delete/create (generate_name)",
+			},
+		},
+		{
+			fixture: "foreign",
+			want: []string{
+				"rancher2_cluster_v2.downstream: update (kubernetes_version)",
+				"rancher2_machine_config_v2.do_nodes: update (digitalocean_config)",
+			},
+		},
+		{
+			fixture: "pools",
+			want:    []string{"rancher2_cluster_v2.downstream: update (kubernetes_version, rke_config)"},
+		},
+		{
+			fixture: "noop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var got []string
+			for _, c := range loadPlan(t, tt.fixture).Changes {
+				got = append(got, c.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestVerifyUpgradeOnly(t *testing.T) {
+	tests := []struct {
+		fixture string
+		wantErr string
+	}{
+		{fixture: "upgrade"},
+		{fixture: "replace", wantErr: "destroys rancher2_cluster_v2.downstream"},
+		{fixture: "foreign", wantErr: "unexpected change rancher2_machine_config_v2.do_nodes"},
+		{fixture: "pools", wantErr: "unexpected attributes changed rancher2_cluster_v2.downstream"},
+		{fixture: "noop", wantErr: "does not change kubernetes_version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			err := loadPlan(t, tt.fixture).VerifyUpgradeOnly()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("VerifyUpgradeOnly = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("VerifyUpgradeOnly = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChangedAttributes(t *testing.T) {
+	pools := func(cred, version interface{}) map[string]interface{} {
+		return map[string]interface{}{"rke_config": []interface{}{map[string]interface{}{
+			"machine_pools": []interface{}{map[string]interface{}{"cloud_credential_secret_name": cred, "quantity": 1.0}},
+		}}, "kubernetes_version": version}
+	}
+	unknownCred := map[string]interface{}{"rke_config": []interface{}{map[string]interface{}{
+		"machine_pools": []interface{}{map[string]interface{}{"cloud_credential_secret_name": true}},
+	}}}
+
+	tests := []struct {
+		name                 string
+		before, after, unkwn map[string]interface{}
+		want                 []string
+	}{
+		{
+			name:   "nested unknown",
+			before: pools("cc-1", "v1.31"),
+			after:  pools(nil, "v1.32"),
+			unkwn:  unknownCred,
+			want:   []string{"kubernetes_version"},
+		},
+		{
+			name:   "nested unknown missing from after",
+			before: pools("cc-1", "v1.31"),
+			after: map[string]interface{}{"kubernetes_version": "v1.31", "rke_config": []interface{}{map[string]interface{}{
+				"machine_pools": []interface{}{map[string]interface{}{"quantity": 1.0}},
+			}}},
+			unkwn: unknownCred,
+		},
+		{
+			name:   "nested known change",
+			before: pools("cc-1", "v1.31"),
+			after:  pools("cc-2", "v1.31"),
+			want:   []string{"rke_config"},
+		},
+		{
+			name:   "top-level unknown",
+			before: map[string]interface{}{"id": "c-1", "resource_version": "12"},
+			after:  map[string]interface{}{"id": "c-1"},
+			unkwn:  map[string]interface{}{"resource_version": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changedAttributes(tt.before, tt.after, tt.unkwn); !slices.Equal(got, tt.want) {
+				t.Errorf("changed = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeTerraform writes a terraform stand-in whose plan saves a plan file
+// and exits with planExit, and whose show prints show (or fails if empty).
+func fakeTerraform(t *testing.T, planExit int, show string) *Binary {
+	t.Helper()
+	dir := t.TempDir()
+	showFile := filepath.Join(dir, "show.json")
+	if err := os.WriteFile(showFile, []byte(show), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+plan) echo secret > %s; exit %d ;;
+show) [ -s %q ] && cat %q || { echo "show failed" >&2; exit 1; } ;;
+esac
+`, planFile, planExit, showFile, showFile)
+	path := filepath.Join(dir, "terraform")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Binary{Name: "terraform", Path: path}
+}
+
+func TestPlanFileRemoved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake terraform is a shell script")
+	}
+	upgrade, err := os.ReadFile(filepath.Join("testdata", "plan-upgrade.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		planExit int
+		show     string
+		wantErr  bool
+	}{
+		{name: "plan fails", planExit: 1, wantErr: true},
+		{name: "show fails", planExit: 2, wantErr: true},
+		{name: "unparseable show", planExit: 2, show: "not json", wantErr: true},
+		{name: "no changes", planExit: 0},
+		{name: "changes", planExit: 2, show: string(upgrade)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Runner{WorkDir: t.TempDir(), Binary: fakeTerraform(t, tt.planExit, tt.show)}
+			path := filepath.Join(r.WorkDir, planFile)
+
+			plan, err := r.Plan()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Plan = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if _, err := os.Stat(path); err != nil {
+					t.Fatalf("plan file not saved: %v", err)
+				}
+				plan.Discard()
+				plan.Discard()
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("plan file left behind: %v", err)
+			}
+		})
+	}
+}
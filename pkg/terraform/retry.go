@@ -0,0 +1,114 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Retry records one retried terraform command for the run report.
+type Retry struct {
+	Op           string    `json:"op"`
+	Attempt      int       `json:"attempt"`
+	Cause        string    `json:"cause"`
+	Error        string    `json:"error"`
+	DelaySeconds int       `json:"delay_seconds"`
+	At           time.Time `json:"at"`
+}
+
+// transientPatterns match error diagnostics caused by Rancher API hiccups
+// rather than by the configuration; the name is reported as the cause.
+var transientPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"bad gateway", regexp.MustCompile(`(?i)502 bad gateway|status(?: ?code)?:? ?\[?502\b`)},
+	{"service unavailable", regexp.MustCompile(`(?i)503 service unavailable|status(?: ?code)?:? ?\[?503\b`)},
+	{"gateway timeout", regexp.MustCompile(`(?i)504 gateway time-?out|status(?: ?code)?:? ?\[?504\b`)},
+	{"rate limited", regexp.MustCompile(`(?i)429 too many requests|status(?: ?code)?:? ?\[?429\b`)},
+	{"update conflict", regexp.MustCompile(`(?i)the object has been modified; please apply your changes to the latest version`)},
+	{"webhook timeout", regexp.MustCompile(`(?i)failed calling webhook.*(timeout|deadline exceeded|connection refused|no endpoints available)`)},
+	{"connection reset", regexp.MustCompile(`(?i)connection reset by peer|broken pipe|unexpected EOF`)},
+	{"network timeout", regexp.MustCompile(`(?i)i/o timeout|tls handshake timeout|client\.Timeout exceeded`)},
+}
+
+// TransientCause classifies a terraform failure. It returns the cause and
+// true only if every error diagnostic (or, without diagnostics, the command
+// output) matches a known transient pattern; anything else is fatal.
+func TransientCause(err error) (string, bool) {
+	var tfErr *Error
+	if !errors.As(err, &tfErr) {
+		return "", false
+	}
+
+	messages := make([]string, 0, len(tfErr.Diagnostics))
+	for _, d := range tfErr.Diagnostics {
+		messages = append(messages, d.Summary+": "+d.Detail)
+	}
+	if len(messages) == 0 {
+		if strings.TrimSpace(tfErr.Stderr) == "" {
+			return "", false
+		}
+		messages = append(messages, tfErr.Stderr)
+	}
+
+	var causes []string
+	for _, msg := range messages {
+		cause := transientMatch(msg)
+		if cause == "" {
+			return "", false
+		}
+		if !slices.Contains(causes, cause) {
+			causes = append(causes, cause)
+		}
+	}
+	return strings.Join(causes, ", "), true
+}
+
+func transientMatch(msg string) string {
+	for _, p := range transientPatterns {
+		if p.re.MatchString(msg) {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// withRetry runs attempt, retrying transient failures up to r.Retries times
+// with exponential backoff starting at r.RetryBackoff.
+func (r *Runner) withRetry(op string, attempt func(n int) error) error {
+	delay := r.RetryBackoff
+	for n := 1; ; n++ {
+		err := attempt(n)
+		if err == nil {
+			return nil
+		}
+		cause, transient := TransientCause(err)
+		if !transient {
+			return err
+		}
+		if n > r.Retries {
+			if r.Retries == 0 {
+				return err
+			}
+			return fmt.Errorf("giving up after %d retries: %w", r.Retries, err)
+		}
+
+		fmt.Printf("  terraform %s failed transiently (%s), retrying in %s (%d/%d)\n", op, cause, delay, n, r.Retries)
+		if r.OnRetry != nil {
+			r.OnRetry(Retry{
+				Op:           op,
+				Attempt:      n,
+				Cause:        cause,
+				Error:        err.Error(),
+				DelaySeconds: int(delay.Seconds()),
+				At:           time.Now().UTC(),
+			})
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
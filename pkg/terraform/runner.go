@@ -7,11 +7,33 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Runner struct {
-	WorkDir  string
-	Provider string
+	SourceDir   string
+	WorkDir     string
+	Provider    string
+	ClusterName string
+	// Binary is the terraform or tofu CLI to run; nil runs terraform from
+	// PATH.
+	Binary *Binary
+	// Labels and Annotations are passed to the config's labels and
+	// annotations variables to mark created resources as ours.
+	Labels      map[string]string
+	Annotations map[string]string
+	// Backend stores state remotely when set; nil keeps local state.
+	Backend *Backend
+	// Retries is how many times transient apply/destroy failures are
+	// retried, starting RetryBackoff apart; OnRetry is told of each retry.
+	Retries      int
+	RetryBackoff time.Duration
+	OnRetry      func(Retry)
+	// LastLog is the log file of the most recent logged terraform command.
+	LastLog string
 }
 
 type Output struct {
@@ -20,59 +42,44 @@ type Output struct {
 	Provider    string
 }
 
-type RunState struct {
-	ClusterDeployed bool   `json:"cluster_deployed"`
-	ClusterUpgraded bool   `json:"cluster_upgraded"`
-	ClusterID       string `json:"cluster_id"`
-	CurrentVersion  string `json:"current_version"`
-}
-
-const stateFile = "run_state.json"
-
-func NewRunner(baseDir, provider string) *Runner {
-	workDir := filepath.Join(baseDir, provider)
+var clusterNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
 
-	return &Runner{
-		WorkDir:  workDir,
-		Provider: provider,
+// ValidateClusterName returns an error unless name is an RFC 1123 label,
+// which Rancher requires of cluster names and which is safe to use as a
+// directory and state key.
+func ValidateClusterName(name string) error {
+	if len(name) > 63 || !clusterNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid cluster name %q: use at most 63 lowercase letters, digits and '-', starting and ending with a letter or digit", name)
 	}
-
+	return nil
 }
 
-func LoadState() *RunState {
-	data, err := os.ReadFile(stateFile)
-	if err != nil {
-		return &RunState{}
-	}
-	var state RunState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return &RunState{}
+// NewRunner returns a runner for one cluster. The provider's terraform
+// config in baseDir/<provider> is only a template: each cluster gets its own
+// working copy under baseDir/.clusters/<cluster>/<provider>, so clusters
+// never share terraform state. clusterName must pass ValidateClusterName.
+func NewRunner(baseDir, provider, clusterName string) *Runner {
+	return &Runner{
+		SourceDir:   filepath.Join(baseDir, provider),
+		WorkDir:     filepath.Join(baseDir, ".clusters", clusterName, provider),
+		Provider:    provider,
+		ClusterName: clusterName,
 	}
-	return &state
 }
 
-func SaveState(state *RunState) error {
-	data, err := json.MarshalIndent(state, "", " ")
+func (r *Runner) Init() error {
+	if err := r.prepareWorkDir(); err != nil {
+		return err
+	}
+	backendArgs, err := r.configureBackend()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(stateFile, data, 0644)
-}
-func ClearState() {
-	os.Remove(stateFile)
-}
-
-func (r *Runner) Init() error {
-	cmd := exec.Command("terraform", "init")
-	cmd.Dir = r.WorkDir
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
 
 	fmt.Println("Running terraform init...")
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform init failed: %s", stderr.String())
+	// init has no -json UI; its output is logged and the tail kept for errors.
+	if err := r.runText("init", append([]string{"init", "-input=false", "-no-color"}, backendArgs...)...); err != nil {
+		return err
 	}
 
 	fmt.Println("terraform initialized")
@@ -92,6 +99,12 @@ cluster_name = "%s"
 		content += fmt.Sprintf(`%s = "%s"
 `, key, value)
 	}
+	if len(r.Labels) > 0 {
+		content += hclMap("labels", r.Labels)
+	}
+	if len(r.Annotations) > 0 {
+		content += hclMap("annotations", r.Annotations)
+	}
 
 	if err := os.WriteFile(tfvarsPath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write tfvars: %w", err)
@@ -102,16 +115,40 @@ cluster_name = "%s"
 }
 
 func (r *Runner) Apply() error {
-	cmd := exec.Command("terraform", "apply", "--auto-approve")
-	cmd.Dir = r.WorkDir
+	return r.withRetry("apply", func(int) error {
+		return r.apply("--auto-approve")
+	})
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// ApplyPlan applies a plan saved by Plan, so exactly the verified changes
+// are made. The plan file is removed afterwards since it contains secrets.
+// A saved plan is stale once an apply has started, so a retry plans again
+// and re-checks that the new plan is still upgrade-only.
+func (r *Runner) ApplyPlan(plan *Plan) error {
+	return r.withRetry("apply", func(attempt int) error {
+		if attempt > 1 {
+			var err error
+			if plan, err = r.Plan(); err != nil {
+				return err
+			}
+			defer plan.Discard()
+			if !plan.HasChanges() {
+				return nil
+			}
+			if err := plan.VerifyUpgradeOnly(); err != nil {
+				return err
+			}
+		}
+		defer plan.Discard()
+		return r.apply(planFile)
+	})
+}
 
+func (r *Runner) apply(args ...string) error {
 	fmt.Println("Running terraform apply (this may take 10-15minutes) ....")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform apply failed: %s\n%s", stderr.String(), stdout.String())
+	args = append([]string{"apply", "-json", "-input=false"}, args...)
+	if _, err := r.runJSON("apply", os.Stdout, args...); err != nil {
+		return err
 	}
 
 	fmt.Println("terraform apply completed")
@@ -119,8 +156,7 @@ func (r *Runner) Apply() error {
 }
 
 func (r *Runner) GetOutputs() (*Output, error) {
-	cmd := exec.Command("terraform", "output", "-json")
-	cmd.Dir = r.WorkDir
+	cmd := r.command("output", "-json")
 
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -145,17 +181,84 @@ func (r *Runner) GetOutputs() (*Output, error) {
 }
 
 func (r *Runner) Destroy() error {
-	cmd := exec.Command("terraform", "destroy", "--auto-approve")
-	cmd.Dir = r.WorkDir
+	fmt.Println("destroying cluster...")
+	err := r.withRetry("destroy", func(int) error {
+		_, err := r.runJSON("destroy", os.Stdout, "destroy", "-json", "-input=false", "--auto-approve")
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	var stderr bytes.Buffer
+	fmt.Println("Cluster destroyed")
+	return nil
+}
+
+// OutputText returns the human-readable `terraform output`, with sensitive
+// values masked by terraform itself.
+func (r *Runner) OutputText() (string, error) {
+	cmd := r.command("output")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	fmt.Println("destroying cluster...")
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform destroy failed: %s", stderr.String())
+		return "", fmt.Errorf("terraform output failed: %s", stderr.String())
 	}
+	return stdout.String(), nil
+}
 
-	fmt.Println("Cluster destroyed")
-	return nil
+// hclMap renders a map(string) variable assignment for a tfvars file.
+func hclMap(name string, values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s = {\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "  %q = %q\n", k, values[k])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// command returns a terraform/tofu command running in the work dir.
+func (r *Runner) command(args ...string) *exec.Cmd {
+	path := "terraform"
+	if r.Binary != nil {
+		path = r.Binary.Path
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Dir = r.WorkDir
+	return cmd
+}
+
+// newLog creates a timestamped log file for one terraform invocation and
+// records it as the runner's LastLog.
+func (r *Runner) newLog(op string) (*os.File, error) {
+	logDir := filepath.Join(r.WorkDir, "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, fmt.Errorf("create terraform log dir: %w", err)
+	}
+
+	path := filepath.Join(logDir, fmt.Sprintf("%s-%s.log", time.Now().Format("20060102-150405"), op))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create terraform log: %w", err)
+	}
+	r.LastLog = path
+	return f, nil
+}
+
+// CLIName returns the name of the CLI the runner invokes, for messages
+// telling the user what to run by hand.
+func (r *Runner) CLIName() string {
+	if r.Binary != nil {
+		return r.Binary.Name
+	}
+	return "terraform"
 }
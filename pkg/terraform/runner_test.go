@@ -0,0 +1,19 @@
+package terraform
+
+import "testing"
+
+func TestValidateClusterName(t *testing.T) {
+	valid := []string{"rancher-test", "a", "nightly-2", "0abc", "a23456789012345678901234567890123456789012345678901234567890123"}
+	invalid := []string{"", "../../x", "my/test", "My-Test", "-test", "test-", "a_b", "a.b", "a234567890123456789012345678901234567890123456789012345678901234"}
+
+	for _, name := range valid {
+		if err := ValidateClusterName(name); err != nil {
+			t.Errorf("ValidateClusterName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := ValidateClusterName(name); err == nil {
+			t.Errorf("ValidateClusterName(%q) = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxErrorDiagnostics caps how many diagnostics an Error message includes.
+const maxErrorDiagnostics = 5
+
+// progressInterval throttles "still creating" lines per resource.
+const progressInterval = 30 * time.Second
+
+// Diagnostic is an error or warning reported by terraform.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Address  string `json:"address,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	s := d.Summary
+	if d.Address != "" {
+		s = d.Address + ": " + s
+	}
+	if d.Detail != "" {
+		s += ": " + strings.Join(strings.Fields(d.Detail), " ")
+	}
+	return s
+}
+
+// Error is returned when a terraform command fails. It carries the error
+// diagnostics terraform reported and the path of the invocation's full log.
+type Error struct {
+	Op          string
+	Diagnostics []Diagnostic
+	Stderr      string
+	Log         string
+	Err         error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "terraform %s failed: %v", e.Op, e.Err)
+
+	diags := e.Diagnostics
+	if len(diags) > maxErrorDiagnostics {
+		diags = diags[len(diags)-maxErrorDiagnostics:]
+	}
+	for _, d := range diags {
+		fmt.Fprintf(&b, "\n  %s", d)
+	}
+	if len(diags) == 0 && strings.TrimSpace(e.Stderr) != "" {
+		fmt.Fprintf(&b, "\n  %s", lastLines(e.Stderr, 10))
+	}
+	if e.Log != "" {
+		fmt.Fprintf(&b, "\n  (full log: %s)", e.Log)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type uiHook struct {
+	Resource struct {
+		Addr string `json:"addr"`
+	} `json:"resource"`
+	Action         string  `json:"action"`
+	IDKey          string  `json:"id_key"`
+	IDValue        string  `json:"id_value"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// uiMessage is one line of terraform's machine-readable UI (-json).
+type uiMessage struct {
+	Level      string      `json:"@level"`
+	Message    string      `json:"@message"`
+	Type       string      `json:"type"`
+	Hook       *uiHook     `json:"hook"`
+	Diagnostic *Diagnostic `json:"diagnostic"`
+	Changes    *struct {
+		Add       int    `json:"add"`
+		Change    int    `json:"change"`
+		Remove    int    `json:"remove"`
+		Operation string `json:"operation"`
+	} `json:"changes"`
+}
+
+var actionVerbs = map[string][2]string{
+	"create":  {"creating", "created"},
+	"update":  {"modifying", "modified"},
+	"delete":  {"destroying", "destroyed"},
+	"replace": {"replacing", "replaced"},
+	"read":    {"reading", "read"},
+	"noop":    {"checking", "checked"},
+}
+
+func verbs(action string) (string, string) {
+	if v, ok := actionVerbs[action]; ok {
+		return v[0], v[1]
+	}
+	return action, action
+}
+
+// progressPrinter renders terraform UI events as resource-level progress.
+type progressPrinter struct {
+	out       io.Writer
+	lastShown map[string]time.Time
+}
+
+func (p *progressPrinter) handle(msg *uiMessage) {
+	switch msg.Type {
+	case "apply_start":
+		ing, _ := verbs(msg.Hook.Action)
+		fmt.Fprintf(p.out, "  %s %s...\n", ing, msg.Hook.Resource.Addr)
+		p.lastShown[msg.Hook.Resource.Addr] = time.Now()
+	case "apply_progress":
+		addr := msg.Hook.Resource.Addr
+		if time.Since(p.lastShown[addr]) < progressInterval {
+			return
+		}
+		ing, _ := verbs(msg.Hook.Action)
+		fmt.Fprintf(p.out, "  %s %s... %s elapsed\n", ing, addr, elapsed(msg.Hook.ElapsedSeconds))
+		p.lastShown[addr] = time.Now()
+	case "apply_complete":
+		_, ed := verbs(msg.Hook.Action)
+		id := ""
+		if msg.Hook.IDValue != "" {
+			id = fmt.Sprintf(" [%s=%s]", msg.Hook.IDKey, msg.Hook.IDValue)
+		}
+		fmt.Fprintf(p.out, "  %s %s%s after %s\n", ed, msg.Hook.Resource.Addr, id, elapsed(msg.Hook.ElapsedSeconds))
+	case "apply_errored":
+		ing, _ := verbs(msg.Hook.Action)
+		fmt.Fprintf(p.out, "  failed %s %s after %s\n", ing, msg.Hook.Resource.Addr, elapsed(msg.Hook.ElapsedSeconds))
+	case "diagnostic":
+		// Errors are reported through the returned *Error instead.
+		if msg.Diagnostic.Severity == "error" {
+			return
+		}
+		fmt.Fprintf(p.out, "  %s: %s\n", msg.Diagnostic.Severity, msg.Diagnostic)
+	case "change_summary":
+		c := msg.Changes
+		fmt.Fprintf(p.out, "  %s: %d to add, %d to change, %d to destroy\n", c.Operation, c.Add, c.Change, c.Remove)
+	}
+}
+
+// runJSON runs a terraform command that supports -json, rendering progress
+// to out (nil to stay quiet) and writing the raw event stream and stderr to
+// a per-invocation log file. It returns the diagnostics terraform reported;
+// on failure the error is an *Error.
+func (r *Runner) runJSON(op string, out io.Writer, args ...string) ([]Diagnostic, error) {
+	logFile, err := r.newLog(op)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	cmd := r.command(args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(&stderr, logFile)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, &Error{Op: op, Err: err, Log: logFile.Name()}
+	}
+
+	var diags []Diagnostic
+	printer := &progressPrinter{out: out, lastShown: map[string]time.Time{}}
+	tee := io.TeeReader(stdout, logFile)
+	scanner := bufio.NewScanner(tee)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg uiMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Type == "diagnostic" && msg.Diagnostic != nil {
+			diags = append(diags, *msg.Diagnostic)
+		}
+		if out != nil && (msg.Hook != nil || msg.Diagnostic != nil || msg.Changes != nil) {
+			printer.handle(&msg)
+		}
+	}
+	// A line too long for the scanner stops the loop early; keep reading so
+	// terraform doesn't block on a full pipe and the log stays complete.
+	scanErr := scanner.Err()
+	io.Copy(io.Discard, tee)
+
+	if err := cmd.Wait(); err != nil {
+		return diags, &Error{Op: op, Diagnostics: errorDiagnostics(diags), Stderr: stderr.String(), Log: logFile.Name(), Err: err}
+	}
+	if scanErr != nil {
+		return diags, &Error{Op: op, Diagnostics: errorDiagnostics(diags), Stderr: stderr.String(), Log: logFile.Name(), Err: fmt.Errorf("read terraform output: %w", scanErr)}
+	}
+	return diags, nil
+}
+
+// runText runs a terraform command without -json support, logging its
+// combined output and keeping the tail for the error message.
+func (r *Runner) runText(op string, args ...string) error {
+	logFile, err := r.newLog(op)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := r.command(args...)
+
+	var output bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&output, logFile)
+	cmd.Stderr = io.MultiWriter(&output, logFile)
+
+	if err := cmd.Run(); err != nil {
+		return &Error{Op: op, Stderr: output.String(), Log: logFile.Name(), Err: err}
+	}
+	return nil
+}
+
+func errorDiagnostics(diags []Diagnostic) []Diagnostic {
+	var errs []Diagnostic
+	for _, d := range diags {
+		if d.Severity == "error" {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+func elapsed(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,203 @@
+package terraform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version. Build metadata is dropped.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+// ParseVersion parses "1.9.8", "v1.9", "1.10.0-beta1" and similar.
+// Missing minor/patch components are zero.
+func ParseVersion(s string) (Version, error) {
+	raw := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+
+	var v Version
+	s, v.Pre, _ = strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", raw)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1. A pre-release sorts before its release.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	default:
+		return comparePre(v.Pre, o.Pre)
+	}
+}
+
+// comparePre orders pre-release tags by their dot-separated identifiers,
+// comparing runs of digits numerically so beta2 sorts before beta10 and
+// rc.2 before rc.10. A number sorts before text, and a tag that is a
+// prefix of another sorts first.
+func comparePre(a, b string) int {
+	as, bs := preParts(a), preParts(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+// preParts splits a pre-release tag at dots and between letters and
+// digits: "beta10.2" is beta, 10, 2.
+func preParts(pre string) []string {
+	var parts []string
+	for _, ident := range strings.Split(pre, ".") {
+		start := 0
+		for i := 1; i < len(ident); i++ {
+			if isDigit(ident[i]) != isDigit(ident[i-1]) {
+				parts = append(parts, ident[start:i])
+				start = i
+			}
+		}
+		parts = append(parts, ident[start:])
+	}
+	return parts
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+type versionBound struct {
+	op string
+	v  Version
+	// parts is how many components the ~> operand had.
+	parts int
+}
+
+// Constraint is a terraform-style version constraint such as
+// ">= 1.6, < 2.0" or "~> 1.9.0". All comma-separated parts must hold.
+type Constraint struct {
+	raw    string
+	bounds []versionBound
+}
+
+// ParseConstraint parses a constraint using =, !=, >, >=, <, <= and ~>.
+// An empty string matches any version.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op := "="
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(strings.TrimPrefix(part, candidate))
+				break
+			}
+		}
+		v, err := ParseVersion(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		core, _, _ := strings.Cut(strings.TrimPrefix(part, "v"), "-")
+		core, _, _ = strings.Cut(core, "+")
+		c.bounds = append(c.bounds, versionBound{op: op, v: v, parts: strings.Count(core, ".") + 1})
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies every part of the constraint.
+func (c *Constraint) Check(v Version) bool {
+	for _, b := range c.bounds {
+		cmp := v.Compare(b.v)
+		ok := false
+		// As in terraform, a range only admits a pre-release when its bound
+		// is a pre-release of the same version.
+		if v.Pre != "" && b.op != "=" && b.op != "!=" && (b.v.Pre == "" || v.Major != b.v.Major || v.Minor != b.v.Minor || v.Patch != b.v.Patch) {
+			return false
+		}
+		switch b.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			// ~> 1.9.0 allows 1.9.x; ~> 1.9 allows 1.x from 1.9 on.
+			ok = cmp >= 0 && v.Major == b.v.Major && (b.parts < 3 || v.Minor == b.v.Minor)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
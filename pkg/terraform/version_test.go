@@ -0,0 +1,153 @@
+package terraform
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.9.8", want: Version{Major: 1, Minor: 9, Patch: 8}},
+		{in: "v1.9.8", want: Version{Major: 1, Minor: 9, Patch: 8}},
+		{in: "1.9", want: Version{Major: 1, Minor: 9}},
+		{in: "v2", want: Version{Major: 2}},
+		{in: "1.10.0-beta1", want: Version{Major: 1, Minor: 10, Pre: "beta1"}},
+		{in: "1.10.0-rc.2+build.5", want: Version{Major: 1, Minor: 10, Pre: "rc.2"}},
+		{in: " 1.6.0\n", want: Version{Major: 1, Minor: 6}},
+		{in: "", wantErr: true},
+		{in: "v", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "1.x", wantErr: true},
+		{in: "1..2", wantErr: true},
+		{in: "terraform", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Each version sorts before the next.
+	ordered := []string{
+		"1.9.0",
+		"1.9.8",
+		"1.10.0-alpha20240501",
+		"1.10.0-alpha20240619",
+		"1.10.0-beta1",
+		"1.10.0-beta2",
+		"1.10.0-beta10",
+		"1.10.0-rc.1",
+		"1.10.0-rc.2",
+		"1.10.0-rc.10",
+		"1.10.0-rc.10.1",
+		"1.10.0",
+		"v1.10.1",
+		"2.0.0",
+	}
+
+	for i, a := range ordered {
+		va, err := ParseVersion(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := va.Compare(va); c != 0 {
+			t.Errorf("%s.Compare(itself) = %d", a, c)
+		}
+		for _, b := range ordered[i+1:] {
+			vb, err := ParseVersion(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := va.Compare(vb); c != -1 {
+				t.Errorf("%s.Compare(%s) = %d, want -1", a, b, c)
+			}
+			if c := vb.Compare(va); c != 1 {
+				t.Errorf("%s.Compare(%s) = %d, want 1", b, a, c)
+			}
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{
+			constraint: "",
+			match:      []string{"0.1.0", "1.9.8", "2.0.0-beta1"},
+		},
+		{
+			constraint: "~> 1.9",
+			match:      []string{"1.9.0", "1.9.8", "1.10.0", "v1.12.3"},
+			noMatch:    []string{"1.8.9", "2.0.0", "1.9.0-beta1"},
+		},
+		{
+			constraint: "~> 1.9.0",
+			match:      []string{"1.9.0", "1.9.8"},
+			noMatch:    []string{"1.8.9", "1.10.0", "2.9.0"},
+		},
+		{
+			constraint: "~> 1.10.0-rc.1",
+			match:      []string{"1.10.0-rc.2", "1.10.0", "1.10.3"},
+			noMatch:    []string{"1.10.0-beta2", "1.11.0"},
+		},
+		{
+			constraint: ">= 1.6, < 2.0",
+			match:      []string{"1.6.0", "v1.9.8", "1.99.0"},
+			noMatch:    []string{"1.5.7", "2.0.0", "2.0.0-beta1", "1.6.0-rc1"},
+		},
+		{
+			constraint: ">= v1.6.0-beta2",
+			match:      []string{"1.6.0-beta10", "1.6.0-rc1", "1.6.0"},
+			noMatch:    []string{"1.6.0-beta1", "1.6.0-alpha3", "1.7.0-beta1"},
+		},
+		{
+			constraint: "= 1.9.8, != 1.9.7",
+			match:      []string{"1.9.8", "v1.9.8+build.1"},
+			noMatch:    []string{"1.9.7", "1.9.9"},
+		},
+		{
+			constraint: "1.9",
+			match:      []string{"1.9.0"},
+			noMatch:    []string{"1.9.1"},
+		},
+		{
+			constraint: "> 1.9, <= 1.10",
+			match:      []string{"1.9.1", "1.10.0"},
+			noMatch:    []string{"1.9.0", "1.10.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) = %v", tt.constraint, err)
+			continue
+		}
+		for _, s := range tt.match {
+			if v, err := ParseVersion(s); err != nil || !c.Check(v) {
+				t.Errorf("%q rejects %s (%v)", tt.constraint, s, err)
+			}
+		}
+		for _, s := range tt.noMatch {
+			if v, err := ParseVersion(s); err != nil || c.Check(v) {
+				t.Errorf("%q accepts %s (%v)", tt.constraint, s, err)
+			}
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, s := range []string{"~>", ">= 1.x", "=> 1.6", ">= 1.6, <", "1.2.3.4", "latest"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) = nil error", s)
+		}
+	}
+}
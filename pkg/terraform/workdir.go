@@ -0,0 +1,170 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prepareWorkDir copies the provider's terraform config into the cluster's
+// working dir, refreshing it on every run so template changes are picked
+// up, and adopts state left in the shared template dir by older versions.
+func (r *Runner) prepareWorkDir() error {
+	if err := os.MkdirAll(r.WorkDir, 0755); err != nil {
+		return fmt.Errorf("create terraform work dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(r.SourceDir)
+	if err != nil {
+		return fmt.Errorf("read terraform config %s: %w", r.SourceDir, err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".tf") || name == ".terraform.lock.hcl") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(r.SourceDir, name))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(r.WorkDir, name), data, 0644); err != nil {
+			return fmt.Errorf("copy %s: %w", name, err)
+		}
+	}
+
+	return r.adoptLegacyState()
+}
+
+// adoptLegacyState moves a terraform.tfstate from the shared template dir
+// into this cluster's work dir, but only if it belongs to this cluster.
+func (r *Runner) adoptLegacyState() error {
+	legacy := filepath.Join(r.SourceDir, "terraform.tfstate")
+	target := filepath.Join(r.WorkDir, "terraform.tfstate")
+
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	owner, err := legacyStateClusterName(legacy)
+	if err != nil {
+		return err
+	}
+	if owner != r.ClusterName {
+		if owner != "" {
+			fmt.Printf("  Note: %s holds state for cluster %q; run with --cluster-name %s to adopt it\n", legacy, owner, owner)
+		}
+		return nil
+	}
+
+	for _, name := range []string{"terraform.tfstate", "terraform.tfstate.backup"} {
+		src := filepath.Join(r.SourceDir, name)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := os.Rename(src, filepath.Join(r.WorkDir, name)); err != nil {
+			return fmt.Errorf("move legacy %s: %w", name, err)
+		}
+	}
+	fmt.Printf("  Moved existing state for %s into %s\n", r.ClusterName, r.WorkDir)
+	return nil
+}
+
+type stateResource struct {
+	Type   string                 `json:"type"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// StateCluster is the rancher2_cluster_v2 recorded in terraform state.
+type StateCluster struct {
+	Name              string
+	ClusterID         string
+	KubernetesVersion string
+}
+
+// StateCluster returns the rancher2_cluster_v2 tracked in the runner's
+// terraform state, or nil if the state holds no cluster.
+func (r *Runner) StateCluster() (*StateCluster, error) {
+	cmd := r.command("show", "-json")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("terraform show failed: %s", stderr.String())
+	}
+
+	var state struct {
+		Values *struct {
+			RootModule struct {
+				Resources []stateResource `json:"resources"`
+			} `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &state); err != nil {
+		return nil, fmt.Errorf("parse terraform state: %w", err)
+	}
+	if state.Values == nil {
+		return nil, nil
+	}
+	for _, res := range state.Values.RootModule.Resources {
+		if res.Type == "rancher2_cluster_v2" {
+			cluster := &StateCluster{}
+			cluster.Name, _ = res.Values["name"].(string)
+			cluster.ClusterID, _ = res.Values["cluster_v1_id"].(string)
+			cluster.KubernetesVersion, _ = res.Values["kubernetes_version"].(string)
+			return cluster, nil
+		}
+	}
+	return nil, nil
+}
+
+// StateClusterName returns the name of the rancher2_cluster_v2 tracked in
+// the runner's terraform state, or "" if the state holds no cluster.
+func (r *Runner) StateClusterName() (string, error) {
+	cluster, err := r.StateCluster()
+	if err != nil || cluster == nil {
+		return "", err
+	}
+	return cluster.Name, nil
+}
+
+// TemplateStateClusterName returns the cluster in terraform state left in
+// the shared template dir baseDir/<provider> by older versions, or "" if
+// there is none.
+func TemplateStateClusterName(baseDir, provider string) string {
+	name, _ := legacyStateClusterName(filepath.Join(baseDir, provider, "terraform.tfstate"))
+	return name
+}
+
+// legacyStateClusterName reads the cluster name straight from a state file
+// without running terraform in the shared dir.
+func legacyStateClusterName(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var state struct {
+		Resources []struct {
+			Type      string `json:"type"`
+			Instances []struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, res := range state.Resources {
+		if res.Type == "rancher2_cluster_v2" && len(res.Instances) > 0 {
+			name, _ := res.Instances[0].Attributes["name"].(string)
+			return name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,339 @@
+package testspec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajeshkio/hosted-rancher-testing/pkg/kubectl"
+)
+
+// Deploy applies the spec's manifests in order.
+func (s *Spec) Deploy(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	for _, m := range s.Manifests {
+		if err := k8s.Apply(ctx, m); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		fmt.Fprintf(w, "  %s: applied %s\n", s.Name, m)
+	}
+	return nil
+}
+
+// Check waits for the spec's resources and runs its log, exec and HTTP
+// checks, stopping at the first failure.
+func (s *Spec) Check(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	for _, step := range []func(context.Context, kubectl.Runner, io.Writer) error{s.WaitReady, s.CheckLogs, s.CheckExec, s.CheckHTTP} {
+		if err := step(ctx, k8s, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitReady waits for the spec's Wait resources, or for every workload in
+// its manifests when it lists none.
+func (s *Spec) WaitReady(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	waits := s.Wait
+	if len(waits) == 0 {
+		for _, m := range s.Manifests {
+			workloads, err := kubectl.ManifestWorkloads(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.Name, err)
+			}
+			for _, wl := range workloads {
+				waits = append(waits, Wait{Kind: wl.Kind, Namespace: wl.Namespace, Name: wl.Name})
+			}
+		}
+	}
+
+	for _, wait := range waits {
+		waitCtx, cancel := context.WithTimeout(ctx, timeout(wait.Timeout, defaultWaitTimeout))
+		err := waitFor(waitCtx, k8s, wait)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", s.Name, wait, err)
+		}
+		fmt.Fprintf(w, "  %s: %s ready\n", s.Name, wait)
+	}
+	return nil
+}
+
+func waitFor(ctx context.Context, k8s kubectl.Runner, wait Wait) error {
+	switch wait.Kind {
+	case "Service", "Ingress":
+		_, err := waitForAddress(ctx, k8s, wait.Kind, wait.Namespace, wait.Name)
+		return err
+	case "Pod":
+	default:
+		return k8s.WaitForRollouts(ctx, []kubectl.Workload{{Kind: wait.Kind, Namespace: wait.Namespace, Name: wait.Name}})
+	}
+	pods := []string{wait.Name}
+	if wait.Name == "" {
+		var err error
+		if pods, err = k8s.GetPods(ctx, wait.Namespace, wait.Selector); err != nil {
+			return err
+		}
+		if len(pods) == 0 {
+			return fmt.Errorf("no pods match %s", wait.Selector)
+		}
+	}
+	for _, pod := range pods {
+		if err := k8s.WaitForPod(ctx, wait.Namespace, pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForAddress polls a Service or Ingress until its load balancer has an
+// address, and returns the first one.
+func waitForAddress(ctx context.Context, k8s kubectl.Runner, kind, namespace, name string) (string, error) {
+	for {
+		addresses, err := k8s.LoadBalancerAddresses(ctx, kind, namespace, name)
+		if err == nil && len(addresses) > 0 {
+			return addresses[0], nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no load balancer address assigned")
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// resolve returns the name of the pod the reference points at.
+func (p PodRef) resolve(ctx context.Context, k8s kubectl.Runner) (string, error) {
+	if p.Pod != "" {
+		return p.Pod, nil
+	}
+	pods, err := k8s.GetPods(ctx, p.Namespace, p.Selector)
+	if err != nil {
+		return "", err
+	}
+	if len(pods) == 0 {
+		return "", fmt.Errorf("no pods in %s match %s", p.Namespace, p.Selector)
+	}
+	return pods[0], nil
+}
+
+// CheckLogs runs the spec's log assertions.
+func (s *Spec) CheckLogs(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	for _, c := range s.Logs {
+		logCtx, cancel := context.WithTimeout(ctx, timeout(c.Timeout, defaultLogsTimeout))
+		n, err := c.run(logCtx, k8s)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: logs of %s: %w", s.Name, c.PodRef, err)
+		}
+		fmt.Fprintf(w, "  %s: logs of %s ok (%d bytes)\n", s.Name, c.PodRef, n)
+	}
+	return nil
+}
+
+func (c LogCheck) run(ctx context.Context, k8s kubectl.Runner) (int, error) {
+	tail := c.Tail
+	if tail <= 0 {
+		tail = defaultTailLines
+	}
+	for {
+		pod, err := c.resolve(ctx, k8s)
+		if err != nil {
+			return 0, err
+		}
+		logs, err := k8s.Logs(ctx, c.Namespace, pod, tail)
+		if err != nil {
+			return 0, err
+		}
+		if c.reject != nil {
+			if m := c.reject.FindString(logs); m != "" {
+				return 0, fmt.Errorf("pod %s logged %q (reject %q)", pod, m, c.Reject)
+			}
+		}
+		if c.expect == nil || c.expect.MatchString(logs) {
+			return len(logs), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("last %d lines of pod %s never matched %q:\n%s", tail, pod, c.Expect, logs)
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// CheckExec runs the spec's exec checks.
+func (s *Spec) CheckExec(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	for _, c := range s.Exec {
+		execCtx, cancel := context.WithTimeout(ctx, timeout(c.Timeout, defaultExecTimeout))
+		output, err := c.run(execCtx, k8s)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: exec %q in %s: %w", s.Name, strings.Join(c.Command, " "), c.PodRef, err)
+		}
+		fmt.Fprintf(w, "  %s: exec %q ok: %s\n", s.Name, strings.Join(c.Command, " "), strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func (c ExecCheck) run(ctx context.Context, k8s kubectl.Runner) (string, error) {
+	pod, err := c.resolve(ctx, k8s)
+	if err != nil {
+		return "", err
+	}
+	output, err := k8s.Exec(ctx, c.Namespace, pod, c.Command)
+	if err != nil {
+		return "", err
+	}
+	if c.expect != nil && !c.expect.MatchString(output) {
+		return "", fmt.Errorf("output %q does not match %q", strings.TrimSpace(output), c.Expect)
+	}
+	return output, nil
+}
+
+// CheckHTTP runs the spec's HTTP probes.
+func (s *Spec) CheckHTTP(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	for _, p := range s.HTTP {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout(p.Timeout, defaultHTTPTimeout))
+		status, err := p.run(probeCtx, k8s)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", s.Name, p, err)
+		}
+		fmt.Fprintf(w, "  %s: %s ok (%d)\n", s.Name, p, status)
+	}
+	return nil
+}
+
+// run retries the probe until it passes or ctx ends, returning the last
+// failure.
+func (p HTTPProbe) run(ctx context.Context, k8s kubectl.Runner) (int, error) {
+	for {
+		status, body, err := p.request(ctx, k8s)
+		if err == nil {
+			err = p.verify(status, body)
+		}
+		if err == nil {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, err
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func (p HTTPProbe) verify(status int, body []byte) error {
+	want := p.Status
+	if want == 0 {
+		want = http.StatusOK
+	}
+	if status != want {
+		return fmt.Errorf("got HTTP %d, want %d", status, want)
+	}
+	if p.expect != nil && !p.expect.Match(body) {
+		return fmt.Errorf("body does not match %q", p.Expect)
+	}
+	return nil
+}
+
+// request sends one request the way the probe asks for.
+func (p HTTPProbe) request(ctx context.Context, k8s kubectl.Runner) (int, []byte, error) {
+	url := p.URL
+	if a := p.Address; a != nil {
+		addresses, err := k8s.LoadBalancerAddresses(ctx, a.Kind, a.Namespace, a.Name)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(addresses) == 0 {
+			return 0, nil, fmt.Errorf("%s has no load balancer address", a)
+		}
+		url = fmt.Sprintf("http://%s%s", net.JoinHostPort(addresses[0], strconv.Itoa(a.port())), p.Path)
+	}
+
+	switch {
+	case p.From != nil:
+		return p.curl(ctx, k8s, url)
+	case p.PortForward != nil:
+		// A fresh forward per attempt, so a restarted pod doesn't leave
+		// the probe talking to a dead stream.
+		f := p.PortForward
+		forward, err := k8s.PortForward(ctx, f.Namespace, f.target(), f.Port)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer forward.Close()
+		return get(ctx, fmt.Sprintf("http://127.0.0.1:%d%s", forward.LocalPort, p.Path), p.Host)
+	}
+	return get(ctx, url, p.Host)
+}
+
+func get(ctx context.Context, url, host string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if host != "" {
+		req.Host = host
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// curl requests url from inside the From pod, which needs curl. The
+// status code is written after the body on its own line.
+func (p HTTPProbe) curl(ctx context.Context, k8s kubectl.Runner, url string) (int, []byte, error) {
+	pod, err := p.From.resolve(ctx, k8s)
+	if err != nil {
+		return 0, nil, err
+	}
+	command := []string{"curl", "-sS", "--max-time", "10", "-w", "\n%{http_code}"}
+	if p.Host != "" {
+		command = append(command, "-H", "Host: "+p.Host)
+	}
+	output, err := k8s.Exec(ctx, p.From.Namespace, pod, append(command, url))
+	if err != nil {
+		return 0, nil, err
+	}
+	i := strings.LastIndex(output, "\n")
+	status, err := strconv.Atoi(strings.TrimSpace(output[i+1:]))
+	if i < 0 || err != nil {
+		return 0, nil, fmt.Errorf("unexpected curl output %q", output)
+	}
+	return status, []byte(output[:i]), nil
+}
+
+// Clean deletes the spec's manifests, last applied first, if the spec asks
+// for cleanup.
+func (s *Spec) Clean(ctx context.Context, k8s kubectl.Runner, w io.Writer) error {
+	if !s.Cleanup {
+		return nil
+	}
+	for i := len(s.Manifests) - 1; i >= 0; i-- {
+		if err := k8s.Delete(ctx, s.Manifests[i]); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		fmt.Fprintf(w, "  %s: deleted %s\n", s.Name, s.Manifests[i])
+	}
+	return nil
+}
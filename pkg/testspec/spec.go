@@ -0,0 +1,350 @@
+// Package testspec loads declarative test specs and runs them against a
+// downstream cluster: apply manifests, wait for resources, then check exec
+// output, logs and HTTP endpoints.
+package testspec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Default timeouts for checks that don't set one.
+const (
+	defaultWaitTimeout = 2 * time.Minute
+	defaultExecTimeout = 15 * time.Second
+	defaultLogsTimeout = 30 * time.Second
+	defaultHTTPTimeout = time.Minute
+	defaultTailLines   = 10
+)
+
+// Spec is one test: the manifests it deploys and the checks that must pass
+// once they are up. Checks run again after an upgrade.
+type Spec struct {
+	Name string `json:"name"`
+	// Manifests are applied in order. Relative paths are resolved against
+	// the spec file's directory.
+	Manifests []string `json:"manifests"`
+	// Wait lists resources that must be ready before the checks run. When
+	// empty, every Deployment, StatefulSet and DaemonSet in the manifests
+	// is waited for.
+	Wait []Wait      `json:"wait,omitempty"`
+	Exec []ExecCheck `json:"exec,omitempty"`
+	Logs []LogCheck  `json:"logs,omitempty"`
+	HTTP []HTTPProbe `json:"http,omitempty"`
+	// Cleanup deletes the manifests' objects at the end of the run.
+	Cleanup bool `json:"cleanup,omitempty"`
+
+	// Path is the file the spec was loaded from.
+	Path string `json:"-"`
+}
+
+// Wait is a resource to wait for. Deployments, StatefulSets and
+// DaemonSets (by name) must finish rolling out; Pods (by name or
+// selector) must be Ready; LoadBalancer Services and Ingresses (by name)
+// must have an address.
+type Wait struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name,omitempty"`
+	Selector  string          `json:"selector,omitempty"`
+	Timeout   metav1.Duration `json:"timeout,omitempty"`
+}
+
+func (w Wait) String() string {
+	if w.Name != "" {
+		return fmt.Sprintf("%s %s/%s", strings.ToLower(w.Kind), w.Namespace, w.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", strings.ToLower(w.Kind), w.Namespace, w.Selector)
+}
+
+// PodRef picks the pod a check runs against: Pod by name, or the first
+// pod matching Selector.
+type PodRef struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod,omitempty"`
+	Selector  string `json:"selector,omitempty"`
+}
+
+func (p PodRef) String() string {
+	if p.Pod != "" {
+		return p.Namespace + "/" + p.Pod
+	}
+	return p.Namespace + "/" + p.Selector
+}
+
+// ExecCheck runs Command in a pod; its stdout must match Expect.
+type ExecCheck struct {
+	PodRef
+	Command []string        `json:"command"`
+	Expect  string          `json:"expect,omitempty"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	expect *regexp.Regexp
+}
+
+// LogCheck reads the last Tail lines of a pod's logs. They must match
+// Expect (retried until Timeout, since lines may not be written yet) and
+// must never match Reject.
+type LogCheck struct {
+	PodRef
+	Tail    int             `json:"tail,omitempty"`
+	Expect  string          `json:"expect,omitempty"`
+	Reject  string          `json:"reject,omitempty"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	expect, reject *regexp.Regexp
+}
+
+// HTTPProbe requests URL until it answers with Status (default 200) and a
+// body matching Expect, or Timeout passes. The request is sent from the
+// harness, or from inside a pod with curl (From). Instead of a URL, a
+// probe may target a Service's or Ingress's load balancer Address, or a
+// PortForward via the Rancher proxy, requesting Path.
+type HTTPProbe struct {
+	URL         string       `json:"url,omitempty"`
+	From        *PodRef      `json:"from,omitempty"`
+	PortForward *PortForward `json:"portForward,omitempty"`
+	Address     *Address     `json:"address,omitempty"`
+	Path        string       `json:"path,omitempty"`
+	// Host overrides the Host header, e.g. to match an Ingress rule.
+	Host string `json:"host,omitempty"`
+
+	Status  int             `json:"status,omitempty"`
+	Expect  string          `json:"expect,omitempty"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	expect *regexp.Regexp
+}
+
+// PortForward is the pod or service port an HTTP probe forwards to.
+type PortForward struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Port      int    `json:"port"`
+}
+
+// target is the kubectl-style port-forward target, e.g. "service/nginx".
+func (f PortForward) target() string {
+	if f.Service != "" {
+		return "service/" + f.Service
+	}
+	return "pod/" + f.Pod
+}
+
+// Address is the Service of type LoadBalancer or Ingress whose first
+// load balancer address an HTTP probe targets, on Port (default 80).
+type Address struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Port      int    `json:"port,omitempty"`
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("%s %s/%s:%d", strings.ToLower(a.Kind), a.Namespace, a.Name, a.port())
+}
+
+func (a Address) port() int {
+	if a.Port == 0 {
+		return 80
+	}
+	return a.Port
+}
+
+func (p HTTPProbe) String() string {
+	var s string
+	switch {
+	case p.PortForward != nil:
+		return fmt.Sprintf("GET %s/%s:%d%s via port-forward", p.PortForward.Namespace, p.PortForward.target(), p.PortForward.Port, p.Path)
+	case p.Address != nil:
+		s = fmt.Sprintf("GET %s%s", p.Address, p.Path)
+	default:
+		s = "GET " + p.URL
+	}
+	if p.Host != "" {
+		s += " (Host " + p.Host + ")"
+	}
+	if p.From != nil {
+		s += " from " + p.From.String()
+	}
+	return s
+}
+
+// Load reads and validates a spec file.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read test spec: %w", err)
+	}
+	spec := &Spec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, fmt.Errorf("parse test spec %s: %w", path, err)
+	}
+	spec.Path = path
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for i, m := range spec.Manifests {
+		if !filepath.IsAbs(m) {
+			spec.Manifests[i] = filepath.Join(filepath.Dir(path), m)
+		}
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("test spec %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// FromManifest is a spec that only applies manifestPath and waits for its
+// workloads, for the --manifest flag.
+func FromManifest(manifestPath string) *Spec {
+	return &Spec{
+		Name:      strings.TrimSuffix(filepath.Base(manifestPath), filepath.Ext(manifestPath)),
+		Manifests: []string{manifestPath},
+		Path:      manifestPath,
+	}
+}
+
+func (s *Spec) validate() error {
+	if len(s.Manifests) == 0 {
+		return fmt.Errorf("no manifests")
+	}
+	for i, w := range s.Wait {
+		switch w.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			if w.Name == "" {
+				return fmt.Errorf("wait[%d]: %s needs a name", i, w.Kind)
+			}
+		case "Pod":
+			if w.Name == "" && w.Selector == "" {
+				return fmt.Errorf("wait[%d]: Pod needs a name or selector", i)
+			}
+		case "Service", "Ingress":
+			if w.Name == "" {
+				return fmt.Errorf("wait[%d]: %s needs a name", i, w.Kind)
+			}
+		default:
+			return fmt.Errorf("wait[%d]: unsupported kind %q (want Deployment, StatefulSet, DaemonSet, Pod, Service or Ingress)", i, w.Kind)
+		}
+		if w.Namespace == "" {
+			return fmt.Errorf("wait[%d]: no namespace", i)
+		}
+	}
+
+	var err error
+	for i := range s.Exec {
+		c := &s.Exec[i]
+		if err := c.PodRef.validate(); err != nil {
+			return fmt.Errorf("exec[%d]: %w", i, err)
+		}
+		if len(c.Command) == 0 {
+			return fmt.Errorf("exec[%d]: no command", i)
+		}
+		if c.expect, err = compile(c.Expect); err != nil {
+			return fmt.Errorf("exec[%d]: expect: %w", i, err)
+		}
+	}
+	for i := range s.Logs {
+		c := &s.Logs[i]
+		if err := c.PodRef.validate(); err != nil {
+			return fmt.Errorf("logs[%d]: %w", i, err)
+		}
+		if c.expect, err = compile(c.Expect); err != nil {
+			return fmt.Errorf("logs[%d]: expect: %w", i, err)
+		}
+		if c.reject, err = compile(c.Reject); err != nil {
+			return fmt.Errorf("logs[%d]: reject: %w", i, err)
+		}
+	}
+	for i := range s.HTTP {
+		p := &s.HTTP[i]
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("http[%d]: %w", i, err)
+		}
+		if p.expect, err = compile(p.Expect); err != nil {
+			return fmt.Errorf("http[%d]: expect: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (p PodRef) validate() error {
+	if p.Namespace == "" {
+		return fmt.Errorf("no namespace")
+	}
+	if p.Pod == "" && p.Selector == "" {
+		return fmt.Errorf("needs a pod or selector")
+	}
+	return nil
+}
+
+func (p HTTPProbe) validate() error {
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("path %q must start with /", p.Path)
+	}
+	if a := p.Address; a != nil {
+		switch {
+		case p.URL != "" || p.PortForward != nil:
+			return fmt.Errorf("address probes take a path, not a url or portForward")
+		case a.Kind != "Service" && a.Kind != "Ingress":
+			return fmt.Errorf("address: unsupported kind %q (want Service or Ingress)", a.Kind)
+		case a.Namespace == "" || a.Name == "":
+			return fmt.Errorf("address: needs a namespace and name")
+		}
+		if p.From != nil {
+			if err := p.From.validate(); err != nil {
+				return fmt.Errorf("from: %w", err)
+			}
+		}
+		return nil
+	}
+	if f := p.PortForward; f != nil {
+		switch {
+		case p.URL != "" || p.From != nil:
+			return fmt.Errorf("portForward probes take a path, not a url or from")
+		case f.Namespace == "":
+			return fmt.Errorf("portForward: no namespace")
+		case (f.Service == "") == (f.Pod == ""):
+			return fmt.Errorf("portForward: needs exactly one of service or pod")
+		case f.Port <= 0:
+			return fmt.Errorf("portForward: no port")
+		}
+		return nil
+	}
+	if p.URL == "" {
+		return fmt.Errorf("no url")
+	}
+	if p.Path != "" {
+		return fmt.Errorf("path is only for address and portForward probes; put it in the url")
+	}
+	if p.From != nil {
+		if err := p.From.validate(); err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	}
+	return nil
+}
+
+// compile returns nil for an empty pattern.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// timeout returns d, or def when d is unset.
+func timeout(d metav1.Duration, def time.Duration) time.Duration {
+	if d.Duration > 0 {
+		return d.Duration
+	}
+	return def
+}
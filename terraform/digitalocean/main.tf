@@ -19,27 +19,44 @@ resource "rancher2_setting" "agent_tls_mode" {
 }
 
 resource "rancher2_cloud_credential" "do" {
-  name = "${var.cluster_name}-cred"
+  name        = "${var.cluster_name}-cred"
+  labels      = var.labels
+  annotations = var.annotations
 
   digitalocean_credential_config {
     access_token = var.do_token
   }
+
+  lifecycle {
+    ignore_changes = [labels, annotations]
+  }
 }
 
 resource "rancher2_machine_config_v2" "do_nodes" {
   generate_name = "${var.cluster_name}-do-pool"
+  labels        = var.labels
+  annotations   = var.annotations
 
   digitalocean_config {
     access_token = var.do_token
     image        = var.do_image
     region       = var.do_region
     size         = var.do_size
+    tags         = var.do_tags
+  }
+
+  # Ownership metadata is stamped at creation; later runs must not
+  # rewrite it (or fail the upgrade-only plan check).
+  lifecycle {
+    ignore_changes = [labels, annotations, digitalocean_config[0].tags]
   }
 }
 
 resource "rancher2_cluster_v2" "downstream" {
   name               = var.cluster_name
   kubernetes_version = var.k3s_version
+  labels             = var.labels
+  annotations        = var.annotations
 
   rke_config {
     machine_pools {
@@ -57,6 +74,10 @@ resource "rancher2_cluster_v2" "downstream" {
     }
   }
 
+  lifecycle {
+    ignore_changes = [labels, annotations]
+  }
+
   depends_on = [rancher2_setting.agent_tls_mode]
 }
 
@@ -21,6 +21,18 @@ variable "k3s_version" {
   type        = string
 }
 
+variable "labels" {
+  description = "Ownership labels for created Rancher objects (set by the test harness)"
+  type        = map(string)
+  default     = {}
+}
+
+variable "annotations" {
+  description = "Ownership annotations for created Rancher objects (set by the test harness)"
+  type        = map(string)
+  default     = {}
+}
+
 variable "node_count" {
   description = "Number of nodes"
   type        = number
@@ -46,6 +58,12 @@ variable "do_size" {
   default     = "s-4vcpu-8gb"
 }
 
+variable "do_tags" {
+  description = "Comma-separated tags for the droplets (set by the test harness)"
+  type        = string
+  default     = ""
+}
+
 variable "do_image" {
   description = "DigitalOcean image"
   type        = string